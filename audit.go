@@ -0,0 +1,61 @@
+package ghait
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+
+	"github.com/isometry/ghait/audit"
+	"github.com/isometry/ghait/permission"
+	"github.com/isometry/ghait/policy"
+)
+
+// recordAudit records the outcome of a token request to the configured
+// audit sink, if any.
+func (g *ghait) recordAudit(ctx context.Context, installationID int64, purpose string, requested *github.InstallationTokenOptions, decision policy.Decision, token *github.InstallationToken, err error) {
+	if g.auditSink == nil {
+		return
+	}
+
+	event := audit.Event{
+		Time:           time.Now().UTC(),
+		Success:        err == nil,
+		AppID:          g.appID,
+		InstallationID: installationID,
+		Provider:       g.provider,
+		Caller:         policy.CallerFromContext(ctx),
+		Profile:        decision.Profile,
+		Purpose:        purpose,
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	if requested != nil {
+		event.RequestedRepositories = requested.Repositories
+		event.RequestedRepositoryIDs = requested.RepositoryIDs
+		event.RequestedPermissions = permission.FromInstallationPermissions(requested.Permissions)
+	}
+
+	if token != nil {
+		event.TokenFingerprint = audit.Fingerprint(token.GetToken())
+		event.GrantedPermissions = permission.FromInstallationPermissions(token.Permissions)
+		for _, repo := range token.Repositories {
+			event.GrantedRepositories = append(event.GrantedRepositories, repo.GetName())
+		}
+		if token.ExpiresAt != nil {
+			expiresAt := token.ExpiresAt.UTC()
+			event.ExpiresAt = &expiresAt
+		}
+		if decision.AdvisoryLifetime > 0 {
+			advisoryExpiresAt := event.Time.Add(decision.AdvisoryLifetime).Truncate(time.Second)
+			event.AdvisoryExpiresAt = &advisoryExpiresAt
+		}
+	}
+
+	if err := g.auditSink.Record(context.WithoutCancel(ctx), event); err != nil {
+		g.logger.Error("failed to record audit event", "installation_id", installationID, "error", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Package audit records every installation token issued, or refused, by ghait.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/isometry/ghait/permission"
+)
+
+// Event describes a single installation token request and its outcome.
+// Events never carry the token itself, only its fingerprint.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+
+	AppID          int64  `json:"app_id"`
+	InstallationID int64  `json:"installation_id"`
+	Provider       string `json:"provider"`
+	Caller         string `json:"caller,omitempty"`
+	Profile        string `json:"profile,omitempty"`
+	// Purpose is set for tokens requested by ghait itself, such as
+	// "repository-listing", and empty for tokens requested by the caller.
+	Purpose string `json:"purpose,omitempty"`
+
+	RequestedRepositories  []string       `json:"requested_repositories,omitempty"`
+	RequestedRepositoryIDs []int64        `json:"requested_repository_ids,omitempty"`
+	RequestedPermissions   permission.Set `json:"requested_permissions,omitempty"`
+	GrantedRepositories    []string       `json:"granted_repositories,omitempty"`
+	GrantedPermissions     permission.Set `json:"granted_permissions,omitempty"`
+	ExpiresAt              *time.Time     `json:"expires_at,omitempty"`
+	// AdvisoryExpiresAt is the end of the advisory lifetime of the token set
+	// by the policy, if any, which is not enforced; the token remains valid
+	// until ExpiresAt.
+	AdvisoryExpiresAt *time.Time `json:"advisory_expires_at,omitempty"`
+	TokenFingerprint  string     `json:"token_fingerprint,omitempty"`
+}
+
+// Sink records audit events.
+type Sink interface {
+	Record(ctx context.Context, event Event) error
+}
+
+// SinkFunc adapts an ordinary function to the Sink interface.
+type SinkFunc func(ctx context.Context, event Event) error
+
+// Record calls f(ctx, event).
+func (f SinkFunc) Record(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+type multiSink []Sink
+
+// Multi returns a Sink recording each event to all of the given sinks.
+func Multi(sinks ...Sink) Sink {
+	return multiSink(sinks)
+}
+
+func (m multiSink) Record(ctx context.Context, event Event) error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Record(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Fingerprint returns a non-reversible identifier for token: the first 16
+// hex digits of its SHA-256 digest.
+func Fingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
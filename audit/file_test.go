@@ -0,0 +1,67 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/audit"
+)
+
+func TestFileSink(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	ctx := context.Background()
+
+	sink, err := audit.NewFileSink(name)
+	require.NoError(t, err)
+	require.NoError(t, sink.Record(ctx, newEvent(true)))
+	require.NoError(t, sink.Close())
+
+	// the file is appended to, not truncated
+	sink, err = audit.NewFileSink(name)
+	require.NoError(t, err)
+	require.NoError(t, sink.Record(ctx, newEvent(false)))
+	require.NoError(t, sink.Close())
+
+	info, err := os.Stat(name)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), testToken)
+
+	// one JSON object per line
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{
+		"time": "2026-01-02T03:04:05Z",
+		"success": true,
+		"app_id": 12345,
+		"installation_id": 67890,
+		"provider": "file",
+		"caller": "ci",
+		"profile": "ci",
+		"requested_repositories": ["service-a"],
+		"requested_permissions": {"contents": "write"},
+		"granted_repositories": ["service-a"],
+		"granted_permissions": {"contents": "read"},
+		"expires_at": "2026-01-02T04:05:06Z",
+		"token_fingerprint": "`+audit.Fingerprint(testToken)+`"
+	}`, lines[0])
+
+	var event audit.Event
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, newEvent(false), event)
+}
+
+func TestFileSink_Invalid(t *testing.T) {
+	_, err := audit.NewFileSink(filepath.Join(t.TempDir(), "missing", "audit.log"))
+	assert.Error(t, err)
+}
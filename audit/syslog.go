@@ -0,0 +1,43 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/syslog"
+)
+
+// SyslogSink records audit events to syslog as JSON messages.
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink returns a SyslogSink connecting to the syslog daemon at
+// raddr over network, or to the local syslog daemon if network is empty.
+func NewSyslogSink(network, raddr, tag string) (*SyslogSink, error) {
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+// Record implements Sink, logging successful requests at info and failed
+// requests at warning severity.
+func (s *SyslogSink) Record(_ context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if !event.Success {
+		return s.writer.Warning(string(data))
+	}
+	return s.writer.Info(string(data))
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,68 @@
+//go:build !windows && !plan9
+
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/audit"
+)
+
+// syslogMessage matches a message as sent by log/syslog to a remote daemon.
+var syslogMessage = regexp.MustCompile(`^<(\d+)>\S+ \S+ (\S+)\[\d+\]: (.*)\n?$`)
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	sink, err := audit.NewSyslogSink("udp", conn.LocalAddr().String(), "ghait-test")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sink.Close() })
+
+	tests := map[string]struct {
+		success  bool
+		priority string
+	}{
+		// LOG_AUTH (4<<3) | LOG_INFO (6)
+		"success": {true, "38"},
+		// LOG_AUTH (4<<3) | LOG_WARNING (4)
+		"failure": {false, "36"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, sink.Record(context.Background(), newEvent(tt.success)))
+
+			buf := make([]byte, 64<<10)
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			n, _, err := conn.ReadFrom(buf)
+			require.NoError(t, err)
+
+			message := string(buf[:n])
+			assert.NotContains(t, message, testToken)
+
+			match := syslogMessage.FindStringSubmatch(message)
+			require.NotNil(t, match, message)
+			assert.Equal(t, tt.priority, match[1])
+			assert.Equal(t, "ghait-test", match[2])
+
+			var event audit.Event
+			require.NoError(t, json.Unmarshal([]byte(match[3]), &event))
+			assert.Equal(t, newEvent(tt.success), event)
+		})
+	}
+}
+
+func TestSyslogSink_Invalid(t *testing.T) {
+	_, err := audit.NewSyslogSink("invalid", "127.0.0.1:514", "ghait-test")
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookSink records audit events by POSTing them as JSON to a URL.
+type WebhookSink struct {
+	url     string
+	client  *http.Client
+	headers http.Header
+}
+
+// WebhookOption configures a WebhookSink.
+type WebhookOption func(*WebhookSink)
+
+// WithHTTPClient configures the HTTP client used to deliver events.
+func WithHTTPClient(client *http.Client) WebhookOption {
+	return func(s *WebhookSink) {
+		s.client = client
+	}
+}
+
+// WithHeader adds a header, such as Authorization, to every delivery.
+func WithHeader(key, value string) WebhookOption {
+	return func(s *WebhookSink) {
+		s.headers.Add(key, value)
+	}
+}
+
+// NewWebhookSink returns a WebhookSink delivering events to url.
+func NewWebhookSink(url string, opts ...WebhookOption) *WebhookSink {
+	s := &WebhookSink{
+		url:     url,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		headers: http.Header{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Record implements Sink.
+func (s *WebhookSink) Record(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for key, values := range s.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook: unexpected status %s", resp.Status)
+	}
+	return nil
+}
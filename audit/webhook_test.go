@@ -0,0 +1,95 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/audit"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var (
+		body   []byte
+		header http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	sink := audit.NewWebhookSink(server.URL, audit.WithHeader("Authorization", "Bearer hook-secret"))
+	require.NoError(t, sink.Record(context.Background(), newEvent(true)))
+
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer hook-secret", header.Get("Authorization"))
+
+	var event audit.Event
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, newEvent(true), event)
+	assert.NotContains(t, string(body), testToken)
+	assert.NotContains(t, string(body), "hook-secret")
+}
+
+func TestWebhookSink_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the request context is only canceled on disconnect once the body is read
+		_, _ = io.Copy(io.Discard, r.Body)
+		switch r.URL.Path {
+		case "/slow":
+			<-r.Context().Done()
+		case "/redirect":
+			http.Redirect(w, r, "/missing", http.StatusFound)
+		default:
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+
+	t.Run("status", func(t *testing.T) {
+		err := audit.NewWebhookSink(server.URL).Record(ctx, newEvent(true))
+		assert.EqualError(t, err, "audit webhook: unexpected status 500 Internal Server Error")
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		err := audit.NewWebhookSink(server.URL+"/redirect").Record(ctx, newEvent(true))
+		assert.EqualError(t, err, "audit webhook: unexpected status 500 Internal Server Error")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		client := &http.Client{Timeout: 50 * time.Millisecond}
+		err := audit.NewWebhookSink(server.URL+"/slow", audit.WithHTTPClient(client)).Record(ctx, newEvent(true))
+		assert.Error(t, err)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		err := audit.NewWebhookSink(server.URL).Record(ctx, newEvent(true))
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		// credentials in the URL are not leaked into the error
+		url := strings.Replace(closed.URL, "http://", "http://user:url-secret@", 1)
+		err := audit.NewWebhookSink(url).Record(ctx, newEvent(true))
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "url-secret")
+	})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/isometry/ghait"
+	"github.com/isometry/ghait/permission"
+	"github.com/isometry/ghait/provider"
+)
+
+const (
+	completionTimeout  = 10 * time.Second
+	completionCacheTTL = 5 * time.Minute
+)
+
+// noLiveCompletion holds the providers never created for completion, as
+// they read stdin or run external commands.
+var noLiveCompletion = []string{"stdin", "exec", "op"}
+
+// newCompletionCmd returns the shell completion command, replacing cobra's default.
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate the autocompletion script for the specified shell",
+		Long: `Generate the autocompletion script for ghait for the specified shell.
+
+Completions for --repository and --installation-id are fetched from GitHub
+using the configured app, and cached for five minutes, unless the key is
+read from stdin or by running a command.`,
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, out := cmd.Root(), cmd.OutOrStdout()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			default:
+				return root.GenPowerShellCompletionWithDesc(out)
+			}
+		},
+	}
+}
+
+// registerCompletions registers dynamic completion functions for the flags of cmd.
+func registerCompletions(cmd *cobra.Command) {
+	_ = cmd.RegisterFlagCompletionFunc("provider", completeProvider)
+	_ = cmd.RegisterFlagCompletionFunc("provider-opt", completeProviderOpt)
+	_ = cmd.RegisterFlagCompletionFunc("permission", completePermission)
+	_ = cmd.RegisterFlagCompletionFunc("scope", completeScope)
+	_ = cmd.RegisterFlagCompletionFunc("repository", completeRepository)
+	_ = cmd.RegisterFlagCompletionFunc("installation-id", completeInstallationID)
+}
+
+func completeProvider(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return provider.Registered(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completePermission completes the last "name=level" pair of a comma-separated list.
+func completePermission(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	prefix, current := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, current = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	var completions []string
+	if name, _, ok := strings.Cut(current, "="); ok {
+		for _, level := range permission.Levels(name) {
+			completions = append(completions, fmt.Sprintf("%s%s=%s", prefix, name, level))
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	for _, name := range permission.Names() {
+		if strings.HasPrefix(name, current) {
+			completions = append(completions, prefix+name+"=")
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+func completeScope(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	_ = registerScopes()
+	return permission.Scopes(), cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeRepository(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	installationID := viper.GetInt64("installation-id")
+	if installationID == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	key := fmt.Sprintf("%d-repositories-%d", viper.GetInt64("app-id"), installationID)
+
+	names, err := cachedCompletions(key, func(ctx context.Context, factory ghait.GHAIT) ([]string, error) {
+		options, err := factory.ResolveRepositories(ctx, installationID, []ghait.RepositorySelector{{Pattern: "*"}})
+		if err != nil {
+			return nil, err
+		}
+		return options.Repositories, nil
+	})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func completeInstallationID(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	key := fmt.Sprintf("%d-installations", viper.GetInt64("app-id"))
+
+	ids, err := cachedCompletions(key, func(ctx context.Context, factory ghait.GHAIT) ([]string, error) {
+		var ids []string
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			installations, resp, err := factory.ListInstallations(ctx, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, installation := range installations {
+				ids = append(ids, fmt.Sprintf("%d\t%s", installation.GetID(), installation.GetAccount().GetLogin()))
+			}
+			if resp.NextPage == 0 {
+				return ids, nil
+			}
+			opts.Page = resp.NextPage
+		}
+	})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
+
+// cachedCompletions returns the completions cached under key, fetching and
+// caching them with a live ghait instance if absent or stale.
+func cachedCompletions(key string, fetch func(context.Context, ghait.GHAIT) ([]string, error)) ([]string, error) {
+	if viper.GetInt64("app-id") == 0 {
+		return nil, nil
+	}
+
+	cacheFile := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		cacheFile = filepath.Join(dir, "ghait", "completion", key+".json")
+		if info, err := os.Stat(cacheFile); err == nil && time.Since(info.ModTime()) < completionCacheTTL {
+			if data, err := os.ReadFile(filepath.Clean(cacheFile)); err == nil {
+				var cached []string
+				if json.Unmarshal(data, &cached) == nil {
+					return cached, nil
+				}
+			}
+		}
+	}
+
+	if slices.Contains(noLiveCompletion, providerName(viper.GetString("key"))) {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+
+	factory, err := ghait.NewGHAIT(ctx, newConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = factory.Close() }()
+
+	completions, err := fetch(ctx, factory)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheFile != "" {
+		if data, err := json.Marshal(completions); err == nil {
+			if os.MkdirAll(filepath.Dir(cacheFile), 0o700) == nil {
+				_ = os.WriteFile(cacheFile, data, 0o600)
+			}
+		}
+	}
+
+	return completions, nil
+}
@@ -5,15 +5,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/user"
+	"path/filepath"
 	"strings"
 
-	"github.com/google/go-github/v80/github"
-	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/isometry/ghait"
+	"github.com/isometry/ghait/audit"
+	"github.com/isometry/ghait/permission"
+	"github.com/isometry/ghait/policy"
 	"github.com/isometry/ghait/provider"
 )
 
@@ -23,6 +28,11 @@ var (
 	date    = "unknown"
 )
 
+var (
+	configFile string
+	configErr  error
+)
+
 func main() {
 	cmd := New()
 	if err := cmd.ExecuteContext(context.Background()); err != nil {
@@ -36,6 +46,9 @@ func New() *cobra.Command {
 		Short:        "Generate an ephemeral GitHub App installation token",
 		SilenceUsage: true,
 		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			if configErr != nil {
+				return configErr
+			}
 			return viper.BindPFlags(cmd.Flags())
 		},
 		RunE:    runToken,
@@ -44,15 +57,39 @@ func New() *cobra.Command {
 
 	cobra.OnInitialize(initConfig)
 
+	cmd.AddCommand(newPermissionsCmd())
+	cmd.AddCommand(newCompletionCmd())
+	cmd.AddCommand(newSignerCmd())
+
+	cmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file (default $XDG_CONFIG_HOME/ghait/config.yaml)")
+
 	flags := cmd.Flags()
 
 	flags.Int64P("app-id", "a", 0, "App ID (required)")
 	flags.Int64P("installation-id", "i", 0, "Installation ID (required)")
-	flags.StringP("key", "k", "", "Private key or identifier (required)")
-	flags.StringP("provider", "P", "file", fmt.Sprintf("KMS provider (supported: [%s])", strings.Join(provider.Registered(), ",")))
-	flags.StringSliceP("repository", "r", nil, "Repository names to grant access to (default all)")
+	flags.StringP("key", "k", "", "Private key, identifier, key URI such as awskms://alias/github, or - to read from stdin (required)")
+	flags.StringP("provider", "P", "", fmt.Sprintf("KMS provider (supported: [%s]) (default file, or from the key URI)", strings.Join(provider.Registered(), ",")))
+	flags.StringToString("provider-opt", nil, "Provider options as name=value, overriding the providers.<provider> config section")
+	flags.StringSliceP("repository", "r", nil, "Repositories to grant access to, by name, glob, topic:<topic> or id:<id> (default all)")
 	flags.StringToStringP("permission", "p", nil, "Restricted permissions to grant")
 	flags.Lookup("permission").DefValue = "all"
+	flags.StringSliceP("scope", "s", nil, fmt.Sprintf("Named permission presets to grant, combined with --permission (built-in: [%s])", strings.Join(permission.Scopes(), ",")))
+	flags.String("policy", "", "Policy file restricting the tokens that may be requested")
+	flags.String("profile", "", "Policy profile to apply (default selected by caller)")
+	flags.String("audit-log", "", "File to which token requests are recorded as JSON lines")
+	flags.Bool("verbose", false, "Print the effective token request")
+	flags.String("log-level", "warn", "Log level (debug, info, warn, error)")
+	flags.String("log-format", "text", "Log format (text, json)")
+
+	registerCompletions(cmd)
+
+	defaultHelp := cmd.HelpFunc()
+	cmd.SetHelpFunc(func(c *cobra.Command, args []string) {
+		defaultHelp(c, args)
+		if c == cmd {
+			_, _ = fmt.Fprint(c.OutOrStdout(), providerOptionsUsage())
+		}
+	})
 
 	return cmd
 }
@@ -61,15 +98,88 @@ func initConfig() {
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.SetEnvPrefix("GHAIT")
+
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	} else {
+		if dir, err := os.UserConfigDir(); err == nil {
+			viper.AddConfigPath(filepath.Join(dir, "ghait"))
+		}
+		viper.SetConfigName("config")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if configFile != "" || !errors.As(err, &notFound) {
+			configErr = fmt.Errorf("read config: %w", err)
+		}
+	}
 }
 
-func runToken(cmd *cobra.Command, _ []string) error {
-	config := ghait.NewConfig(
+// registerScopes registers the user-defined permission presets from the
+// "scopes" section of the config file.
+func registerScopes() error {
+	for name := range viper.GetStringMap("scopes") {
+		permissions, err := permission.Parse(viper.GetStringMapString("scopes." + name))
+		if err != nil {
+			return fmt.Errorf("scope %q: %w", name, err)
+		}
+		if err := permission.RegisterScope(name, permissions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newLogger returns a logger writing to w at the given level and format.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+// newConfig returns the ghait configuration from flags, environment and config file.
+func newConfig() ghait.Config {
+	key := viper.GetString("key")
+	name := providerName(key)
+
+	return ghait.NewConfig(
 		viper.GetInt64("app-id"),
 		viper.GetInt64("installation-id"),
-		strings.ToLower(viper.GetString("provider")),
-		viper.GetString("key"),
-	)
+		name,
+		key,
+	).WithProviderOptions(providerOptions(name))
+}
+
+// providerName returns the name of the provider selected by --provider,
+// defaulting to that implied by key: stdin for "-", the provider of the
+// scheme of a key URI, or else file.
+func providerName(key string) string {
+	if name := strings.ToLower(viper.GetString("provider")); name != "" {
+		return name
+	}
+	if key == "-" {
+		return "stdin"
+	}
+	if name, _, _, err := provider.ParseURI(key); err == nil && provider.IsURI(key) {
+		return name
+	}
+	return "file"
+}
+
+func runToken(cmd *cobra.Command, _ []string) error {
+	config := newConfig()
 
 	if config.GetAppID() == 0 {
 		return errors.New("app-id is required")
@@ -79,22 +189,90 @@ func runToken(cmd *cobra.Command, _ []string) error {
 		return errors.New("installation-id is required")
 	}
 
-	factory, err := ghait.NewGHAIT(cmd.Context(), config)
+	if err := registerScopes(); err != nil {
+		return err
+	}
+
+	overrides, err := permission.Parse(viper.GetStringMapString("permission"))
+	if err != nil {
+		return fmt.Errorf("invalid permissions: %w", err)
+	}
+
+	permissions, err := permission.Resolve(viper.GetStringSlice("scope"), overrides)
+	if err != nil {
+		return err
+	}
+
+	selectors, err := ghait.ParseRepositorySelectors(viper.GetStringSlice("repository"))
+	if err != nil {
+		return err
+	}
+
+	verbose := viper.GetBool("verbose")
+	if verbose {
+		effective := permissions.String()
+		if effective == "" {
+			effective = "all"
+		}
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Permissions: %s\n", effective)
+	}
+
+	logger, err := newLogger(cmd.ErrOrStderr(), viper.GetString("log-level"), viper.GetString("log-format"))
 	if err != nil {
 		return err
 	}
 
-	permissions := &github.InstallationPermissions{}
-	if err = mapstructure.Decode(viper.GetStringMapString("permission"), permissions); err != nil {
-		return fmt.Errorf("decode permissions: %w", err)
+	opts := []ghait.Option{ghait.WithLogger(logger)}
+
+	if auditLog := viper.GetString("audit-log"); auditLog != "" {
+		sink, err := audit.NewFileSink(auditLog)
+		if err != nil {
+			return fmt.Errorf("open audit log: %w", err)
+		}
+		defer func() { _ = sink.Close() }()
+		opts = append(opts, ghait.WithAuditSink(sink))
+	}
+
+	ctx := cmd.Context()
+	if u, err := user.Current(); err == nil {
+		ctx = policy.WithCaller(ctx, u.Username)
+	}
+
+	if policyFile := viper.GetString("policy"); policyFile != "" {
+		p, err := policy.Load(policyFile)
+		if err != nil {
+			return fmt.Errorf("load policy: %w", err)
+		}
+		opts = append(opts, ghait.WithPolicy(p))
+
+		if profile := viper.GetString("profile"); profile != "" {
+			ctx = policy.WithProfile(ctx, profile)
+		}
+	}
+
+	factory, err := ghait.NewGHAIT(ctx, config, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = factory.Close() }()
+
+	tokenOptions, err := factory.ResolveRepositories(ctx, 0, selectors)
+	if err != nil {
+		return err
+	}
+	if len(permissions) > 0 {
+		tokenOptions.Permissions = permissions.InstallationPermissions()
 	}
 
-	tokenOptions := &github.InstallationTokenOptions{
-		Repositories: viper.GetStringSlice("repository"),
-		Permissions:  permissions,
+	if verbose && len(selectors) > 0 {
+		repositories := tokenOptions.Repositories
+		for _, id := range tokenOptions.RepositoryIDs {
+			repositories = append(repositories, fmt.Sprintf("id:%d", id))
+		}
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "Repositories: %s\n", strings.Join(repositories, ","))
 	}
 
-	token, err := factory.NewTokenWithOptions(cmd.Context(), tokenOptions)
+	token, err := factory.NewTokenWithOptions(ctx, tokenOptions)
 	if err != nil {
 		return err
 	}
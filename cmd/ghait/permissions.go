@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/isometry/ghait/permission"
+)
+
+func newPermissionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "permissions",
+		Short: "Inspect GitHub App installation permissions",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List every known permission with its allowed levels",
+		Args:  cobra.NoArgs,
+		RunE:  runPermissionsList,
+	})
+
+	return cmd
+}
+
+func runPermissionsList(cmd *cobra.Command, _ []string) error {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PERMISSION\tLEVELS")
+	for _, name := range permission.Names() {
+		levels := permission.Levels(name)
+		names := make([]string, len(levels))
+		for i, l := range levels {
+			names[i] = string(l)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", name, strings.Join(names, ","))
+	}
+	return w.Flush()
+}
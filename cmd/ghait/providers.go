@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/isometry/ghait/provider"
+)
+
+// providerOptions returns the options for the named provider, from the
+// "providers.<name>" section of the config file overridden by --provider-opt.
+func providerOptions(name string) map[string]string {
+	options := viper.GetStringMapString("providers." + name)
+	maps.Copy(options, viper.GetStringMapString("provider-opt"))
+	return options
+}
+
+// providerOptionsUsage returns the help text describing the options of
+// every registered provider.
+func providerOptionsUsage() string {
+	var b strings.Builder
+	b.WriteString("\nProvider Options (--provider-opt name=value):\n")
+
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, name := range slices.Sorted(slices.Values(provider.Registered())) {
+		options := provider.OptionSpecs(name)
+		if len(options) == 0 {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "  %s:\n", name)
+		for _, o := range options {
+			description := o.Description
+			if len(o.Allowed) > 0 {
+				description += fmt.Sprintf(" (%s)", strings.Join(o.Allowed, "|"))
+			}
+			_, _ = fmt.Fprintf(w, "    %s %s\t%s\n", o.Name, o.Type, description)
+		}
+	}
+	_ = w.Flush()
+
+	return b.String()
+}
+
+// completeProviderOpt completes the option names of the selected provider.
+func completeProviderOpt(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	name, _ := cmd.Flags().GetString("provider")
+
+	var completions []string
+	if option, _, ok := strings.Cut(toComplete, "="); ok {
+		for _, o := range provider.OptionSpecs(name) {
+			if o.Name == option {
+				for _, value := range o.Allowed {
+					completions = append(completions, option+"="+value)
+				}
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	for _, o := range provider.OptionSpecs(name) {
+		completions = append(completions, fmt.Sprintf("%s=\t%s", o.Name, o.Description))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
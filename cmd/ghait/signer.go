@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/signer"
+)
+
+func newSignerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "signer",
+		Short: "Serve GitHub App JWT signing to remote clients",
+	}
+
+	serve := &cobra.Command{
+		Use:   "serve",
+		Short: "Sign GitHub App JWTs for clients of the remote provider over mutual TLS",
+		Args:  cobra.NoArgs,
+		RunE:  runSignerServe,
+	}
+
+	flags := serve.Flags()
+	flags.StringP("key", "k", "", "Private key, identifier or key URI (required)")
+	flags.StringP("provider", "P", "", fmt.Sprintf("KMS provider (supported: [%s]) (default file, or from the key URI)", strings.Join(provider.Registered(), ",")))
+	flags.StringToString("provider-opt", nil, "Provider options as name=value, overriding the providers.<provider> config section")
+	flags.String("listen", ":8443", "Address on which to listen")
+	flags.String("tls-cert", "", "PEM file holding the server certificate (required)")
+	flags.String("tls-key", "", "PEM file holding the server private key (required)")
+	flags.String("client-ca", "", "PEM file holding the CA certificates verifying clients (required)")
+	flags.StringSlice("allow-app-id", nil, "App IDs for which to sign (required)")
+	flags.StringSlice("allow-client", nil, "Client certificate common names or DNS or URI SANs to authorize (required unless --allow-any-client)")
+	flags.Bool("allow-any-client", false, "Authorize any client presenting a certificate verified by the client CA")
+	flags.Duration("max-lifetime", signer.DefaultMaxLifetime, "Maximum lifetime of a signed JWT")
+	flags.String("log-level", "info", "Log level (debug, info, warn, error)")
+	flags.String("log-format", "text", "Log format (text, json)")
+
+	serve.MarkFlagsMutuallyExclusive("allow-client", "allow-any-client")
+	_ = serve.RegisterFlagCompletionFunc("provider", completeProvider)
+	_ = serve.RegisterFlagCompletionFunc("provider-opt", completeProviderOpt)
+
+	cmd.AddCommand(serve)
+	return cmd
+}
+
+func runSignerServe(cmd *cobra.Command, _ []string) error {
+	for _, name := range []string{"key", "tls-cert", "tls-key", "client-ca"} {
+		if viper.GetString(name) == "" {
+			return fmt.Errorf("%s is required", name)
+		}
+	}
+
+	if len(viper.GetStringSlice("allow-client")) == 0 && !viper.GetBool("allow-any-client") {
+		return errors.New("allow-client is required, unless allow-any-client is set")
+	}
+
+	var appIDs []int64
+	for _, s := range viper.GetStringSlice("allow-app-id") {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid app ID %q", s)
+		}
+		appIDs = append(appIDs, id)
+	}
+
+	logger, err := newLogger(cmd.ErrOrStderr(), viper.GetString("log-level"), viper.GetString("log-format"))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	key := viper.GetString("key")
+	name := providerName(key)
+	p, err := provider.NewSignerWithOptions(provider.WithLogger(ctx, logger), name, key, providerOptions(name))
+	if err != nil {
+		return fmt.Errorf("%s signer: %w", name, err)
+	}
+	if closer, ok := p.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+	if err := p.Check(ctx); err != nil {
+		return fmt.Errorf("%s signer: %w", name, err)
+	}
+
+	handler, err := signer.NewHandler(p, signer.Config{
+		AppIDs:         appIDs,
+		Clients:        viper.GetStringSlice("allow-client"),
+		AllowAnyClient: viper.GetBool("allow-any-client"),
+		MaxLifetime:    viper.GetDuration("max-lifetime"),
+	}, logger)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := signer.ServerTLSConfig(viper.GetString("tls-cert"), viper.GetString("tls-key"), viper.GetString("client-ca"))
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              viper.GetString("listen"),
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServeTLS("", "") }()
+	logger.Info("serving signer", "address", server.Addr, "provider", name, "app_ids", appIDs)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down signer")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -8,11 +8,19 @@ type Config interface {
 	GetKey() string
 }
 
+// ProviderOptionsConfig is implemented by a Config carrying options for
+// the provider, as declared by [provider.OptionSpecs].
+type ProviderOptionsConfig interface {
+	Config
+	GetProviderOptions() map[string]string
+}
+
 type ghaitConfig struct {
-	appID          int64  `mapstructure:"appId"`
-	installationID int64  `mapstructure:"installationId"`
-	provider       string `mapstructure:"provider"`
-	key            string `mapstructure:"key"`
+	appID           int64             `mapstructure:"appId"`
+	installationID  int64             `mapstructure:"installationId"`
+	provider        string            `mapstructure:"provider"`
+	key             string            `mapstructure:"key"`
+	providerOptions map[string]string `mapstructure:"providerOptions"`
 }
 
 // NewConfig creates a new Config instance.
@@ -44,3 +52,14 @@ func (c *ghaitConfig) GetProvider() string {
 func (c *ghaitConfig) GetKey() string {
 	return c.key
 }
+
+// WithProviderOptions sets the provider options, returning the Config.
+func (c *ghaitConfig) WithProviderOptions(options map[string]string) *ghaitConfig {
+	c.providerOptions = options
+	return c
+}
+
+// GetProviderOptions returns the provider options.
+func (c *ghaitConfig) GetProviderOptions() map[string]string {
+	return c.providerOptions
+}
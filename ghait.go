@@ -8,13 +8,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"slices"
 
-	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/gofri/go-github-ratelimit/v2/github_ratelimit"
 	"github.com/google/go-github/v80/github"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/isometry/ghait/audit"
+	"github.com/isometry/ghait/permission"
+	"github.com/isometry/ghait/policy"
 	"github.com/isometry/ghait/provider"
 )
 
@@ -32,6 +41,10 @@ func (e TransientError) Error() string {
 	return "transient token error"
 }
 
+func isTransient(err error) bool {
+	return errors.Is(err, TransientError{})
+}
+
 func wrapTokenResponseError(resp *github.Response, err error) error {
 	if resp != nil && resp.StatusCode == http.StatusGatewayTimeout {
 		return errors.Join(TransientError{}, err)
@@ -46,16 +59,34 @@ type GHAIT interface {
 	NewInstallationToken(ctx context.Context, installationID int64, options *github.InstallationTokenOptions) (*github.InstallationToken, error)
 	NewToken(ctx context.Context) (*github.InstallationToken, error)
 	NewTokenWithOptions(ctx context.Context, options *github.InstallationTokenOptions) (*github.InstallationToken, error)
+	ListInstallations(ctx context.Context, opts *github.ListOptions) ([]*github.Installation, *github.Response, error)
+	ResolveRepositories(ctx context.Context, installationID int64, selectors []RepositorySelector) (*github.InstallationTokenOptions, error)
+	Stats() Stats
+	RateLimit() github.Rate
+	Close() error
 }
 
 type ghait struct {
-	appID          int64
-	installationID int64
-	Client         *github.Client
+	appID           int64
+	installationID  int64
+	Client          *github.Client
+	provider        string
+	policy          policy.Policy
+	logger          *slog.Logger
+	tracerProvider  trace.TracerProvider
+	meterProvider   metric.MeterProvider
+	telemetry       *telemetry
+	stats           *stats
+	auditSink       audit.Sink
+	rateLimitPolicy RateLimitPolicy
+	signer          provider.Provider
+	baseURL         string
+	transport       http.RoundTripper
+	closer          io.Closer
 }
 
 // NewGHAIT returns a new GitHub App Installation Token instance.
-func NewGHAIT(ctx context.Context, cfg Config) (*ghait, error) {
+func NewGHAIT(ctx context.Context, cfg Config, opts ...Option) (*ghait, error) {
 	if cfg == nil {
 		return nil, errors.New("config is nil")
 	}
@@ -64,40 +95,101 @@ func NewGHAIT(ctx context.Context, cfg Config) (*ghait, error) {
 		return nil, errors.New("no GitHub App ID configured")
 	}
 
-	var (
-		signer provider.Provider
-		err    error
-	)
+	g := &ghait{
+		appID:          cfg.GetAppID(),
+		installationID: cfg.GetInstallationID(),
+		provider:       cfg.GetProvider(),
+		logger:         slog.New(slog.DiscardHandler),
+		stats:          newStats(),
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	// a key URI selects the provider by its scheme
+	if g.provider == "" && g.signer == nil && provider.IsURI(cfg.GetKey()) {
+		name, _, _, err := provider.ParseURI(cfg.GetKey())
+		if err != nil {
+			return nil, err
+		}
+		g.provider = name
+	}
+
+	var err error
+	if g.telemetry, err = newTelemetry(g.tracerProvider, g.meterProvider); err != nil {
+		return nil, fmt.Errorf("telemetry: %w", err)
+	}
+
+	signer := g.signer
 
-	if slices.Contains[[]string](provider.Registered(), cfg.GetProvider()) {
-		signer, err = provider.NewSigner(ctx, cfg.GetProvider(), cfg.GetKey())
+	if signer != nil {
+		if g.provider == "" {
+			g.provider = "custom"
+		}
+		g.logger.Debug("using configured signer", "provider", g.provider)
+	} else if slices.Contains[[]string](provider.Registered(), g.provider) {
+		g.logger.Debug("creating signer", "provider", g.provider)
+		var options provider.Options
+		if oc, ok := cfg.(ProviderOptionsConfig); ok {
+			options = oc.GetProviderOptions()
+		}
+		signer, err = provider.NewSignerWithOptions(provider.WithLogger(ctx, g.logger), cfg.GetProvider(), cfg.GetKey(), options)
 		if err != nil {
-			return nil, fmt.Errorf("%s signer: %w", cfg.GetProvider(), err)
+			g.logger.Error("signer creation failed", "provider", g.provider, "error", err)
+			return nil, fmt.Errorf("%s signer: %w", g.provider, err)
 		}
+		// only signers created here are ours to close
+		g.closer, _ = signer.(io.Closer)
+	} else if g.provider == "" {
+		return nil, errors.New("no provider configured, and key is not a key URI of a registered scheme")
 	} else {
-		return nil, fmt.Errorf("unsupported provider: %s", cfg.GetProvider())
+		g.logger.Error("unsupported provider", "provider", g.provider, "registered", provider.Registered())
+		return nil, fmt.Errorf("unsupported provider: %s", g.provider)
 	}
 
-	if err := signer.Check(); err != nil {
+	if err := signer.Check(provider.WithAppID(ctx, g.appID)); err != nil {
+		g.logger.Error("signer check failed", "provider", g.provider, "error", err)
+		_ = g.Close()
 		return nil, fmt.Errorf("signer check: %w", err)
 	}
+	g.logger.Info("signer ready", "provider", g.provider, "app_id", g.appID)
 
-	appsTransport, err := ghinstallation.NewAppsTransportWithOptions(
-		http.DefaultTransport,
-		cfg.GetAppID(),
-		ghinstallation.WithSigner(signer),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("apps transport: %w", err)
+	var transport http.RoundTripper = http.DefaultTransport
+	if g.tracerProvider != nil || g.meterProvider != nil {
+		transport = otelhttp.NewTransport(transport,
+			otelhttp.WithTracerProvider(g.telemetry.tracerProvider),
+			otelhttp.WithMeterProvider(g.telemetry.meterProvider),
+		)
 	}
+	g.transport = transport
 
-	rateLimitWaiterClient := github_ratelimit.NewClient(appsTransport)
+	rateLimitWaiterClient := github_ratelimit.NewClient(&appsTransport{
+		base:   &rateTransport{base: transport, stats: g.stats},
+		appID:  g.appID,
+		signer: newInstrumentedSigner(signer, g.provider, g.logger, g.telemetry, g.stats),
+	})
 
-	return &ghait{
-		appID:          cfg.GetAppID(),
-		installationID: cfg.GetInstallationID(),
-		Client:         github.NewClient(rateLimitWaiterClient),
-	}, nil
+	g.Client = github.NewClient(rateLimitWaiterClient)
+
+	if g.baseURL != "" {
+		if g.Client, err = g.Client.WithEnterpriseURLs(g.baseURL, g.baseURL); err != nil {
+			_ = g.Close()
+			return nil, fmt.Errorf("base URL: %w", err)
+		}
+	}
+
+	return g, nil
+}
+
+// Close releases the resources held by the signer created by the ghait
+// instance, such as a plugin process or the renewal of a Vault token.
+// Signers configured with WithSigner are left to the caller to close.
+func (g *ghait) Close() error {
+	if g.closer == nil {
+		return nil
+	}
+	return g.closer.Close()
 }
 
 // GetAppID returns the GitHub App ID of the ghait instance.
@@ -110,6 +202,11 @@ func (g *ghait) GetInstallationID() int64 {
 	return g.installationID
 }
 
+// ListInstallations lists the installations of the GitHub App.
+func (g *ghait) ListInstallations(ctx context.Context, opts *github.ListOptions) ([]*github.Installation, *github.Response, error) {
+	return g.Client.Apps.ListInstallations(ctx, opts)
+}
+
 // NewInstallationToken returns a new GitHub App installation token for
 // the specified installation, with optional override of the
 // installation ID. If the installation ID is not provided, it will use
@@ -117,19 +214,108 @@ func (g *ghait) GetInstallationID() int64 {
 // All errors are wrapped in a custom error type to allow for easy error
 // classification: FatalError for errors that should not be retried,
 // TransientError for errors that may be retried.
+// If a policy is configured, the request is evaluated against it first and
+// rejected with a [policy.DeniedError] or downscoped as the policy dictates.
+// If an audit sink is configured, every request is recorded to it.
 func (g *ghait) NewInstallationToken(ctx context.Context, installationID int64, options *github.InstallationTokenOptions) (*github.InstallationToken, error) {
+	return g.newInstallationToken(ctx, installationID, options, "")
+}
+
+// newInstallationToken issues an installation token for purpose, empty for
+// tokens requested by the caller. Tokens issued for ghait's own purposes are
+// not evaluated against the policy, but are otherwise throttled, counted and
+// audited alike.
+func (g *ghait) newInstallationToken(ctx context.Context, installationID int64, options *github.InstallationTokenOptions, purpose string) (*github.InstallationToken, error) {
 	if installationID == 0 {
-		if g.installationID == 0 {
-			return nil, wrapTokenResponseError(nil, errors.New("no GitHub App Installation ID configured"))
-		}
 		installationID = g.installationID
 	}
 
+	attrs := []attribute.KeyValue{
+		attribute.String("ghait.provider", g.provider),
+		attribute.Int64("ghait.app_id", g.appID),
+		attribute.Int64("ghait.installation_id", installationID),
+	}
+	if purpose != "" {
+		attrs = append(attrs, attribute.String("ghait.purpose", purpose))
+	}
+
+	ctx, span := g.telemetry.tracer.Start(ctx, "ghait.NewInstallationToken", trace.WithAttributes(attrs...))
+	defer span.End()
+
+	requested := options
+	var decision policy.Decision
+
+	fail := func(err error) (*github.InstallationToken, error) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "token request failed")
+		g.telemetry.tokenErrors.Add(ctx, 1, metric.WithAttributes(append(attrs, errorClass(err))...))
+		g.stats.recordError(err)
+		g.recordAudit(ctx, installationID, purpose, requested, decision, nil, err)
+		return nil, err
+	}
+
+	if installationID == 0 {
+		return fail(wrapTokenResponseError(nil, errors.New("no GitHub App Installation ID configured")))
+	}
+
+	if options != nil {
+		for name, level := range permission.FromInstallationPermissions(options.Permissions) {
+			if err := permission.Validate(name, level); err != nil {
+				return fail(wrapTokenResponseError(nil, err))
+			}
+		}
+	}
+
+	if g.policy != nil && purpose == "" {
+		var err error
+		options, decision, err = g.applyPolicy(ctx, installationID, options)
+		if err != nil {
+			g.logger.Warn("token request rejected", "installation_id", installationID, "error", err)
+			return fail(wrapTokenResponseError(nil, err))
+		}
+	}
+
+	if err := g.throttle(ctx); err != nil {
+		g.logger.Warn("token request throttled", "installation_id", installationID, "error", err)
+		return fail(err)
+	}
+
+	installationToken, err := g.createInstallationToken(ctx, installationID, options)
+	if err != nil {
+		return fail(err)
+	}
+
+	g.telemetry.tokensIssued.Add(ctx, 1, metric.WithAttributes(attrs...))
+	g.stats.recordToken(TokenKey{InstallationID: installationID, Profile: decision.Profile})
+	g.recordAudit(ctx, installationID, purpose, requested, decision, installationToken, nil)
+
+	return installationToken, nil
+}
+
+// createInstallationToken requests an installation token from GitHub.
+func (g *ghait) createInstallationToken(ctx context.Context, installationID int64, options *github.InstallationTokenOptions) (*github.InstallationToken, error) {
+	logger := g.logger.With("installation_id", installationID)
+	if options != nil {
+		permissions := permission.FromInstallationPermissions(options.Permissions).String()
+		if permissions == "" {
+			permissions = "all"
+		}
+		logger = logger.With(
+			"repositories", len(options.Repositories)+len(options.RepositoryIDs),
+			"permissions", permissions,
+		)
+	}
+	logger.Debug("requesting installation token")
+
 	installationToken, resp, err := g.Client.Apps.CreateInstallationToken(ctx, installationID, options)
 	if err != nil {
-		return nil, fmt.Errorf("create installation token: %w", wrapTokenResponseError(resp, err))
+		err = wrapTokenResponseError(resp, err)
+		logger.Error("installation token request failed", "transient", isTransient(err), "error", err)
+		return nil, fmt.Errorf("create installation token: %w", err)
 	}
 
+	logger.Info("installation token issued", "expires_at", installationToken.GetExpiresAt())
+
 	return installationToken, nil
 }
 
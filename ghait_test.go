@@ -0,0 +1,631 @@
+package ghait_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v80/github"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/isometry/ghait"
+	"github.com/isometry/ghait/audit"
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/permission"
+	"github.com/isometry/ghait/policy"
+	"github.com/isometry/ghait/provider"
+	_ "github.com/isometry/ghait/provider/remote"
+	"github.com/isometry/ghait/signer"
+	"github.com/isometry/ghait/signer/signertest"
+)
+
+// newTestServer returns a fake GitHub API server with app 12345, installed
+// as installation 67890, and the provider holding the app's private key.
+func newTestServer(t *testing.T) (*ghaittest.Server, *ghaittest.Provider) {
+	t.Helper()
+
+	p, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	server := ghaittest.NewServer()
+	t.Cleanup(server.Close)
+
+	server.AddApp(12345, p.PublicKey())
+	server.AddInstallation(ghaittest.Installation{
+		ID:          67890,
+		AppID:       12345,
+		Account:     "example",
+		Permissions: permission.Set{"contents": permission.Write, "metadata": permission.Read},
+		Repositories: []ghaittest.Repository{
+			{ID: 1, Name: "service-a", Topics: []string{"deploy"}},
+			{ID: 2, Name: "service-b"},
+			{ID: 3, Name: "docs", Topics: []string{"deploy"}},
+		},
+	})
+
+	return server, p
+}
+
+func TestNewInstallationToken_Instrumentation(t *testing.T) {
+	server, p := newTestServer(t)
+	server.SetRateLimit(github.Rate{Limit: 5000, Remaining: 4999, Reset: github.Timestamp{Time: time.Now().Add(time.Hour)}})
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	var events []audit.Event
+	sink := audit.SinkFunc(func(_ context.Context, event audit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "file", string(p.PrivateKeyPEM())),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithTracerProvider(tp),
+		ghait.WithAuditSink(sink),
+	)
+	require.NoError(t, err)
+
+	token, err := factory.NewTokenWithOptions(ctx, &github.InstallationTokenOptions{
+		Permissions: &github.InstallationPermissions{Contents: github.Ptr("read")},
+	})
+	require.NoError(t, err)
+	require.Len(t, server.Tokens(), 1)
+	assert.Equal(t, server.Tokens()[0].Token, token.GetToken())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	root := spans[len(spans)-1]
+	assert.Equal(t, "ghait.NewInstallationToken", root.Name())
+	for _, child := range spans[:len(spans)-1] {
+		assert.Equal(t, root.SpanContext().SpanID(), child.Parent().SpanID(), child.Name())
+	}
+	assert.Equal(t, "ghait.Sign", spans[0].Name())
+
+	stats := factory.Stats()
+	assert.Equal(t, map[ghait.TokenKey]uint64{{InstallationID: 67890}: 1}, stats.TokensIssued)
+	assert.Equal(t, uint64(1), stats.SignLatency.Count)
+	assert.Equal(t, 4999, stats.RateLimit.Remaining)
+	assert.Zero(t, stats.FatalErrors+stats.TransientErrors)
+
+	require.Len(t, events, 1)
+	assert.True(t, events[0].Success)
+	assert.Equal(t, int64(67890), events[0].InstallationID)
+	assert.Equal(t, "file", events[0].Provider)
+	assert.Equal(t, audit.Fingerprint(token.GetToken()), events[0].TokenFingerprint)
+	assert.Equal(t, permission.Set{"contents": permission.Read}, events[0].GrantedPermissions)
+	assert.NotContains(t, fmt.Sprint(events[0]), token.GetToken())
+}
+
+func TestNewInstallationToken_Metrics(t *testing.T) {
+	server, p := newTestServer(t)
+
+	// a meter provider alone suffices for HTTP client metrics
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithSigner(p),
+		ghait.WithMeterProvider(mp),
+	)
+	require.NoError(t, err)
+
+	_, err = factory.NewToken(ctx)
+	require.NoError(t, err)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(ctx, &rm))
+
+	var names []string
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names = append(names, m.Name)
+		}
+	}
+	assert.Contains(t, names, "http.client.request.duration")
+}
+
+func TestNewInstallationToken_Errors(t *testing.T) {
+	tests := map[string]struct {
+		setup     func(*ghaittest.Server)
+		options   *github.InstallationTokenOptions
+		transient bool
+	}{
+		"unknown installation": {
+			setup: func(server *ghaittest.Server) {
+				server.AddInstallation(ghaittest.Installation{ID: 67890, AppID: 99999})
+			},
+		},
+		"excess permission": {
+			options: &github.InstallationTokenOptions{
+				Permissions: &github.InstallationPermissions{Contents: github.Ptr("admin")},
+			},
+		},
+		"inaccessible repository": {
+			options: &github.InstallationTokenOptions{Repositories: []string{"other"}},
+		},
+		"gateway timeout": {
+			setup: func(server *ghaittest.Server) {
+				server.FailNext(http.MethodPost, "/app/installations/*/access_tokens", http.StatusGatewayTimeout, 1)
+			},
+			transient: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server, p := newTestServer(t)
+			if tt.setup != nil {
+				tt.setup(server)
+			}
+
+			ctx := context.Background()
+			factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+				ghait.WithBaseURL(server.BaseURL()),
+				ghait.WithSigner(p),
+			)
+			require.NoError(t, err)
+
+			_, err = factory.NewTokenWithOptions(ctx, tt.options)
+			require.Error(t, err)
+			assert.Equal(t, tt.transient, errors.Is(err, ghait.TransientError{}))
+			assert.Equal(t, !tt.transient, errors.Is(err, ghait.FatalError{}))
+			assert.Empty(t, server.Tokens())
+		})
+	}
+}
+
+func TestNewInstallationToken_UnregisteredKey(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	other, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithSigner(other),
+	)
+	require.NoError(t, err)
+
+	_, err = factory.NewToken(ctx)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "401")
+	assert.Equal(t, int64(1), other.SignCount())
+}
+
+func TestNewInstallationToken_KeyURI(t *testing.T) {
+	server, p := newTestServer(t)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, p.PrivateKeyPEM(), 0o600))
+
+	var events []audit.Event
+	sink := audit.SinkFunc(func(_ context.Context, event audit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", "file://"+path),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithAuditSink(sink),
+	)
+	require.NoError(t, err)
+
+	_, err = factory.NewToken(ctx)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "file", events[0].Provider)
+}
+
+func TestNewGHAIT_InvalidKeyURI(t *testing.T) {
+	tests := map[string]struct {
+		key      string
+		expected string
+	}{
+		"empty reference": {"file://", `invalid key URI "file://": empty reference`},
+		"invalid option":  {"file:///key.pem?nosuch=1", `unknown option "nosuch"`},
+		"unknown scheme":  {"nosuch://key", "no provider configured, and key is not a key URI of a registered scheme"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ghait.NewGHAIT(context.Background(), ghait.NewConfig(12345, 67890, "", tt.key))
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestResolveRepositories(t *testing.T) {
+	server, p := newTestServer(t)
+
+	var events []audit.Event
+	sink := audit.SinkFunc(func(_ context.Context, event audit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithSigner(p),
+		ghait.WithAuditSink(sink),
+	)
+	require.NoError(t, err)
+
+	options, err := factory.ResolveRepositories(ctx, 0, []ghait.RepositorySelector{
+		{Pattern: "service-*"},
+		{Topic: "deploy"},
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"service-a", "service-b", "docs"}, options.Repositories)
+
+	// the listing token is revoked after use
+	tokens := server.Tokens()
+	require.Len(t, tokens, 1)
+	assert.True(t, tokens[0].Revoked)
+	assert.Equal(t, permission.Set{"metadata": permission.Read}, tokens[0].Permissions)
+
+	// and audited as such
+	require.Len(t, events, 1)
+	assert.Equal(t, "repository-listing", events[0].Purpose)
+	assert.Equal(t, permission.Set{"metadata": permission.Read}, events[0].RequestedPermissions)
+
+	token, err := factory.NewTokenWithOptions(ctx, options)
+	require.NoError(t, err)
+	assert.Len(t, token.Repositories, 3)
+	require.Len(t, events, 2)
+	assert.Empty(t, events[1].Purpose)
+}
+
+func TestResolveRepositories_Unmatched(t *testing.T) {
+	server, p := newTestServer(t)
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithSigner(p),
+	)
+	require.NoError(t, err)
+
+	_, err = factory.ResolveRepositories(ctx, 0, []ghait.RepositorySelector{
+		{Pattern: "service-*"},
+		{Name: "docs"},
+		{Name: "missing"},
+		{ID: 3},
+		{ID: 99},
+	})
+	assert.EqualError(t, err, "no accessible repository matches missing, id:99")
+}
+
+func TestNewInstallationToken_Context(t *testing.T) {
+	server, p := newTestServer(t)
+
+	type key struct{}
+
+	// the construction context must not be retained
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "construction"))
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithSigner(p),
+	)
+	require.NoError(t, err)
+	cancel()
+
+	_, err = factory.NewToken(context.WithValue(context.Background(), key{}, "request"))
+	require.NoError(t, err)
+	signCtx := p.LastContext()
+	require.NotNil(t, signCtx)
+	assert.Equal(t, "request", signCtx.Value(key{}))
+	assert.NoError(t, signCtx.Err())
+
+	// the request context must reach the signer
+	ctx, cancel = context.WithCancel(context.WithValue(context.Background(), key{}, "canceled"))
+	cancel()
+	_, err = factory.NewToken(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, server.Tokens(), 1)
+	signCtx = p.LastContext()
+	assert.Equal(t, "canceled", signCtx.Value(key{}))
+	assert.ErrorIs(t, signCtx.Err(), context.Canceled)
+}
+
+// closingProvider is a ghaittest.Provider recording whether it was closed.
+type closingProvider struct {
+	*ghaittest.Provider
+	checkErr error
+	closed   int
+}
+
+func (p *closingProvider) Check(context.Context) error {
+	return p.checkErr
+}
+
+func (p *closingProvider) Close() error {
+	p.closed++
+	return nil
+}
+
+func TestClose(t *testing.T) {
+	server, p := newTestServer(t)
+
+	var created []*closingProvider
+	provider.Register("ghaittest-closing", func(_ context.Context, key string) (provider.Provider, error) {
+		c := &closingProvider{Provider: p}
+		if key == "invalid" {
+			c.checkErr = errors.New("invalid key")
+		}
+		created = append(created, c)
+		return c, nil
+	})
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "ghaittest-closing", "valid"),
+		ghait.WithBaseURL(server.BaseURL()),
+	)
+	require.NoError(t, err)
+	_, err = factory.NewToken(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, created, 1)
+	assert.Zero(t, created[0].closed)
+	require.NoError(t, factory.Close())
+	assert.Equal(t, 1, created[0].closed)
+
+	// signers failing their check are closed at once
+	_, err = ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "ghaittest-closing", "invalid"),
+		ghait.WithBaseURL(server.BaseURL()),
+	)
+	require.Error(t, err)
+	require.Len(t, created, 2)
+	assert.Equal(t, 1, created[1].closed)
+
+	// configured signers belong to the caller
+	configured := &closingProvider{Provider: p}
+	factory, err = ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithSigner(configured),
+	)
+	require.NoError(t, err)
+	require.NoError(t, factory.Close())
+	assert.Zero(t, configured.closed)
+}
+
+func TestNewGHAIT_RemoteAppID(t *testing.T) {
+	server, p := newTestServer(t)
+
+	handler, err := signer.NewHandler(p, signer.Config{AppIDs: []int64{12345}, Clients: []string{"ci-runner"}}, nil)
+	require.NoError(t, err)
+	signingServer, err := signertest.NewServer(handler)
+	require.NoError(t, err)
+	t.Cleanup(signingServer.Close)
+
+	certFile, keyFile, err := signingServer.IssueClient("ci-runner")
+	require.NoError(t, err)
+	options := map[string]string{"cert_file": certFile, "key_file": keyFile, "ca_file": signingServer.CAFile}
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "remote", signingServer.URL).WithProviderOptions(options),
+		ghait.WithBaseURL(server.BaseURL()),
+	)
+	require.NoError(t, err)
+	defer factory.Close()
+	_, err = factory.NewToken(ctx)
+	require.NoError(t, err)
+
+	_, err = ghait.NewGHAIT(ctx, ghait.NewConfig(54321, 67890, "remote", signingServer.URL).WithProviderOptions(options),
+		ghait.WithBaseURL(server.BaseURL()),
+	)
+	assert.EqualError(t, err, "signer check: signing server does not sign for app ID 54321")
+}
+
+func TestNewInstallationToken_Policy(t *testing.T) {
+	server, p := newTestServer(t)
+
+	config, err := policy.Parse([]byte(`
+mode: enforce
+profiles:
+  deploy:
+    callers: ["deploy-*"]
+    repositories: ["service-*"]
+    permissions:
+      contents: write
+    mode: downscope
+  read-only:
+    callers: ["reader"]
+    permissions:
+      contents: read
+`))
+	require.NoError(t, err)
+
+	// allow returns a policy allowing every request with the decision d
+	allow := func(d policy.Decision) policy.Policy {
+		return policy.Func(func(context.Context, policy.Request) (policy.Decision, error) {
+			d.Allowed = true
+			return d, nil
+		})
+	}
+
+	requested := &github.InstallationTokenOptions{
+		Repositories: []string{"service-a", "docs"},
+		Permissions:  &github.InstallationPermissions{Contents: github.Ptr("write"), Metadata: github.Ptr("read")},
+	}
+
+	tests := map[string]struct {
+		policy       policy.Policy
+		caller       string
+		repositories []string
+		permissions  permission.Set
+		err          string
+	}{
+		"denied": {
+			policy: config,
+			caller: "reader",
+			err:    "denied by policy: profile \"read-only\": permission contents=write exceeds read",
+		},
+		"downscoped": {
+			policy:       config,
+			caller:       "deploy-bot",
+			repositories: []string{"service-a"},
+			permissions:  permission.Set{"contents": permission.Write},
+		},
+		"allowed without restrictions": {
+			policy:       allow(policy.Decision{}),
+			repositories: []string{"service-a", "docs"},
+			permissions:  permission.Set{"contents": permission.Write, "metadata": permission.Read},
+		},
+		"allowed with wider restrictions": {
+			policy:       allow(policy.Decision{Repositories: []string{"docs", "service-b"}, Permissions: permission.Set{"contents": permission.Admin, "issues": permission.Write}}),
+			repositories: []string{"docs"},
+			permissions:  permission.Set{"contents": permission.Write},
+		},
+		"allowed with narrower permissions": {
+			policy:       allow(policy.Decision{Permissions: permission.Set{"contents": permission.Read}}),
+			repositories: []string{"service-a", "docs"},
+			permissions:  permission.Set{"contents": permission.Read},
+		},
+		"allowed with disjoint repositories": {
+			policy: allow(policy.Decision{Repositories: []string{"service-b"}}),
+			err:    "denied by policy: no requested repository is permitted",
+		},
+		"allowed with disjoint permissions": {
+			policy: allow(policy.Decision{Permissions: permission.Set{"issues": permission.Read}}),
+			err:    "denied by policy: no requested permission is permitted",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := policy.WithCaller(context.Background(), tt.caller)
+			factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "file", string(p.PrivateKeyPEM())),
+				ghait.WithBaseURL(server.BaseURL()),
+				ghait.WithPolicy(tt.policy),
+			)
+			require.NoError(t, err)
+
+			token, err := factory.NewTokenWithOptions(ctx, requested)
+			if tt.err != "" {
+				var denied *policy.DeniedError
+				assert.ErrorAs(t, err, &denied)
+				assert.EqualError(t, denied, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			var repositories []string
+			for _, repo := range token.Repositories {
+				repositories = append(repositories, repo.GetName())
+			}
+			assert.ElementsMatch(t, tt.repositories, repositories)
+			assert.Equal(t, tt.permissions, permission.FromInstallationPermissions(token.Permissions))
+		})
+	}
+}
+
+func TestNewInstallationToken_AdvisoryLifetime(t *testing.T) {
+	server, p := newTestServer(t)
+
+	config, err := policy.Parse([]byte(`
+profiles:
+  short:
+    callers: ["*"]
+    advisoryLifetime: 15m
+`))
+	require.NoError(t, err)
+
+	var events []audit.Event
+	sink := audit.SinkFunc(func(_ context.Context, event audit.Event) error {
+		events = append(events, event)
+		return nil
+	})
+
+	ctx := policy.WithCaller(context.Background(), "someone")
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "file", string(p.PrivateKeyPEM())),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithPolicy(config),
+		ghait.WithAuditSink(sink),
+	)
+	require.NoError(t, err)
+
+	token, err := factory.NewToken(ctx)
+	require.NoError(t, err)
+
+	// the expiry is GitHub's own, the advisory lifetime is audited alone
+	tokens := server.Tokens()
+	require.Len(t, tokens, 1)
+	assert.True(t, tokens[0].ExpiresAt.Equal(token.GetExpiresAt().Time))
+
+	require.Len(t, events, 1)
+	assert.True(t, token.GetExpiresAt().Time.Equal(*events[0].ExpiresAt))
+	require.NotNil(t, events[0].AdvisoryExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), *events[0].AdvisoryExpiresAt, 5*time.Second)
+}
+
+func TestAppsTransport_Claims(t *testing.T) {
+	p, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"token":"ghs_test","expires_at":"2030-01-01T00:00:00Z"}`)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.URL+"/api/v3/"),
+		ghait.WithSigner(p),
+	)
+	require.NoError(t, err)
+
+	for range 2 {
+		_, err = factory.NewToken(ctx)
+		require.NoError(t, err)
+	}
+
+	// a JWT is signed afresh for every request, never cached
+	require.Len(t, authorizations, 2)
+	assert.Equal(t, int64(2), p.SignCount())
+
+	signed, ok := strings.CutPrefix(authorizations[1], "Bearer ")
+	require.True(t, ok)
+	var claims jwt.MapClaims
+	_, err = jwt.ParseWithClaims(signed, &claims, func(*jwt.Token) (any, error) {
+		return p.PublicKey(), nil
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	require.NoError(t, err)
+
+	// the claims are exactly those of ghinstallation.AppsTransport:
+	// integral timestamps, backdated by 30s, valid for two minutes
+	assert.ElementsMatch(t, []string{"iss", "iat", "exp"}, slices.Collect(maps.Keys(claims)))
+	assert.Equal(t, "12345", claims["iss"])
+	iat, exp := claims["iat"].(float64), claims["exp"].(float64)
+	assert.Equal(t, math.Trunc(iat), iat)
+	assert.InDelta(t, time.Now().Add(-30*time.Second).Unix(), iat, 2)
+	assert.Equal(t, float64(120), exp-iat)
+}
@@ -0,0 +1,85 @@
+package ghaittest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Provider is an in-memory provider.Provider signing with a generated RSA key.
+type Provider struct {
+	key   *rsa.PrivateKey
+	count atomic.Int64
+	err   atomic.Pointer[error]
+	ctx   atomic.Pointer[context.Context]
+}
+
+// NewProvider returns a Provider with a freshly generated 2048-bit RSA key.
+func NewProvider() (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{key: key}, nil
+}
+
+// Check implements provider.Provider.
+func (p *Provider) Check(context.Context) error {
+	return nil
+}
+
+// SignContext implements provider.Provider, failing if ctx is done.
+func (p *Provider) SignContext(ctx context.Context, claims jwt.Claims) (string, error) {
+	p.count.Add(1)
+	p.ctx.Store(&ctx)
+	if err := p.err.Load(); err != nil {
+		return "", *err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(p.key)
+}
+
+// FailWith causes subsequent calls to SignContext to fail with err, or to succeed
+// again if err is nil.
+func (p *Provider) FailWith(err error) {
+	if err == nil {
+		p.err.Store(nil)
+		return
+	}
+	p.err.Store(&err)
+}
+
+// SignCount returns the number of calls to SignContext.
+func (p *Provider) SignCount() int64 {
+	return p.count.Load()
+}
+
+// LastContext returns the context passed to the most recent call to
+// SignContext, or nil if none.
+func (p *Provider) LastContext() context.Context {
+	if ctx := p.ctx.Load(); ctx != nil {
+		return *ctx
+	}
+	return nil
+}
+
+// PublicKey returns the public key corresponding to the signing key.
+func (p *Provider) PublicKey() *rsa.PublicKey {
+	return &p.key.PublicKey
+}
+
+// PrivateKeyPEM returns the signing key in the PKCS#1 PEM form accepted by
+// the file provider.
+func (p *Provider) PrivateKeyPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(p.key),
+	})
+}
@@ -0,0 +1,556 @@
+// Package ghaittest provides a fake GitHub App API server and an in-memory
+// signing provider for testing code built on ghait without network access.
+package ghaittest
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/go-github/v80/github"
+
+	"github.com/isometry/ghait/permission"
+)
+
+// MaxJWTLifetime is the maximum lifetime of an app JWT accepted by the server.
+const MaxJWTLifetime = 10 * time.Minute
+
+// TokenLifetime is the lifetime of the installation tokens issued by the server.
+const TokenLifetime = time.Hour
+
+// Repository is a repository accessible to an installation.
+type Repository struct {
+	ID     int64
+	Name   string
+	Topics []string
+}
+
+// Installation is an installation of a registered app.
+type Installation struct {
+	ID    int64
+	AppID int64
+	// Account is the login of the organization or user owning the installation.
+	Account string
+	// User marks the account as a user rather than an organization.
+	User bool
+	// Permissions are the permissions granted to the installation.
+	Permissions permission.Set
+	// Repositories are the repositories accessible to the installation.
+	Repositories []Repository
+}
+
+// Token is an installation token issued by the server.
+type Token struct {
+	Token          string
+	InstallationID int64
+	Permissions    permission.Set
+	// Repositories is nil if the token grants access to all repositories of
+	// the installation.
+	Repositories []Repository
+	ExpiresAt    time.Time
+	Revoked      bool
+}
+
+// Server is a fake GitHub API server implementing the endpoints used to
+// issue GitHub App installation tokens.
+//
+// App JWTs are verified against the public keys registered with AddApp, and
+// token requests are rejected unless their permissions and repositories are
+// a subset of those of the installation.
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	apps          map[int64]*rsa.PublicKey
+	installations map[int64]*Installation
+	tokens        map[string]*Token
+	faults        []*fault
+	latency       time.Duration
+	rate          github.Rate
+}
+
+// fault is a failure injected into matching requests.
+type fault struct {
+	method  string
+	pattern string
+	status  int
+	count   int
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		apps:          map[int64]*rsa.PublicKey{},
+		installations: map[int64]*Installation{},
+		tokens:        map[string]*Token{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /app", s.app(s.getApp))
+	mux.HandleFunc("GET /app/installations", s.app(s.listInstallations))
+	mux.HandleFunc("GET /app/installations/{id}", s.app(s.getInstallation))
+	mux.HandleFunc("POST /app/installations/{id}/access_tokens", s.app(s.createToken))
+	mux.HandleFunc("GET /repos/{owner}/{repo}/installation", s.app(s.findRepositoryInstallation))
+	mux.HandleFunc("GET /orgs/{org}/installation", s.app(s.findAccountInstallation(false)))
+	mux.HandleFunc("GET /users/{user}/installation", s.app(s.findAccountInstallation(true)))
+	mux.HandleFunc("GET /installation/repositories", s.installation(s.listRepositories))
+	mux.HandleFunc("DELETE /installation/token", s.installation(s.revokeToken))
+
+	s.Server = httptest.NewServer(s.intercept(mux))
+	return s
+}
+
+// BaseURL returns the GitHub Enterprise style API base URL of the server,
+// suitable for ghait.WithBaseURL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/api/v3/"
+}
+
+// AddApp registers an app with the public key against which its JWTs are verified.
+func (s *Server) AddApp(appID int64, key *rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apps[appID] = key
+}
+
+// AddInstallation registers an installation of a registered app.
+func (s *Server) AddInstallation(installation Installation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.installations[installation.ID] = &installation
+}
+
+// Tokens returns the installation tokens issued by the server, in no particular order.
+func (s *Server) Tokens() []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make([]Token, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, *token)
+	}
+	return tokens
+}
+
+// SetLatency delays every subsequent response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = d
+}
+
+// SetRateLimit sets the primary rate limit state reported in the
+// X-RateLimit headers of every subsequent response.
+func (s *Server) SetRateLimit(rate github.Rate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rate = rate
+}
+
+// FailNext causes the next n requests with the given method and a path
+// matching pattern, as per path.Match, to fail with status.
+// Paths exclude any "/api/v3" prefix.
+func (s *Server) FailNext(method, pattern string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = append(s.faults, &fault{method: method, pattern: pattern, status: status, count: n})
+}
+
+// intercept strips any GitHub Enterprise path prefix and applies the
+// configured latency, rate limit and faults before dispatching to next.
+func (s *Server) intercept(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"), "api/v3/")
+
+		s.mu.Lock()
+		latency, rate := s.latency, s.rate
+		status := 0
+		for _, f := range s.faults {
+			if f.count > 0 && f.method == r.Method {
+				if ok, _ := path.Match(f.pattern, r.URL.Path); ok {
+					f.count--
+					status = f.status
+					break
+				}
+			}
+		}
+		s.mu.Unlock()
+
+		if latency > 0 {
+			timer := time.NewTimer(latency)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if rate.Limit > 0 {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rate.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(rate.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(rate.Reset.Unix(), 10))
+		}
+
+		if status != 0 {
+			writeError(w, status, "injected fault")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// app authenticates requests with an app JWT, passing the app ID to next.
+func (s *Server) app(next func(http.ResponseWriter, *http.Request, int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		appID, err := s.verifyJWT(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		next(w, r, appID)
+	}
+}
+
+// verifyJWT verifies the app JWT bearer token of r, returning its issuer.
+func (s *Server) verifyJWT(r *http.Request) (int64, error) {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return 0, errors.New("missing app JWT bearer token")
+	}
+
+	var appID int64
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(bearer, claims, func(token *jwt.Token) (any, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		id, err := strconv.ParseInt(claims.Issuer, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid issuer %q", claims.Issuer)
+		}
+		s.mu.Lock()
+		key, ok := s.apps[id]
+		s.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown app %d", id)
+		}
+		appID = id
+		return key, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("invalid JWT: %w", err)
+	}
+
+	if claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		return 0, errors.New("'Issued at' and 'Expiration time' claims are required")
+	}
+	if claims.ExpiresAt.Sub(claims.IssuedAt.Time) > MaxJWTLifetime {
+		return 0, errors.New("'Expiration time' claim ('exp') is too far in the future")
+	}
+
+	return appID, nil
+}
+
+// installation authenticates requests with an installation token, passing
+// the token to next.
+func (s *Server) installation(next func(http.ResponseWriter, *http.Request, *Token)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		value, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok {
+			value, ok = strings.CutPrefix(auth, "token ")
+		}
+
+		s.mu.Lock()
+		token := s.tokens[value]
+		s.mu.Unlock()
+
+		if !ok || token == nil || token.Revoked || time.Now().After(token.ExpiresAt) {
+			writeError(w, http.StatusUnauthorized, "Bad credentials")
+			return
+		}
+		next(w, r, token)
+	}
+}
+
+func (s *Server) getApp(w http.ResponseWriter, _ *http.Request, appID int64) {
+	writeJSON(w, http.StatusOK, &github.App{
+		ID:   github.Ptr(appID),
+		Slug: github.Ptr(fmt.Sprintf("app-%d", appID)),
+		Name: github.Ptr(fmt.Sprintf("App %d", appID)),
+	})
+}
+
+func (s *Server) listInstallations(w http.ResponseWriter, r *http.Request, appID int64) {
+	s.mu.Lock()
+	var installations []*github.Installation
+	for _, installation := range s.installations {
+		if installation.AppID == appID {
+			installations = append(installations, installation.github())
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(installations, func(a, b *github.Installation) int {
+		return cmp.Compare(a.GetID(), b.GetID())
+	})
+
+	writeJSON(w, http.StatusOK, paginate(w, r, installations))
+}
+
+func (s *Server) getInstallation(w http.ResponseWriter, r *http.Request, appID int64) {
+	installation, ok := s.lookupInstallation(w, r, appID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, installation.github())
+}
+
+func (s *Server) findRepositoryInstallation(w http.ResponseWriter, r *http.Request, appID int64) {
+	owner, repo := r.PathValue("owner"), r.PathValue("repo")
+	s.findInstallation(w, appID, func(installation *Installation) bool {
+		return strings.EqualFold(installation.Account, owner) && slices.ContainsFunc(installation.Repositories, func(r Repository) bool {
+			return strings.EqualFold(r.Name, repo)
+		})
+	})
+}
+
+func (s *Server) findAccountInstallation(user bool) func(http.ResponseWriter, *http.Request, int64) {
+	return func(w http.ResponseWriter, r *http.Request, appID int64) {
+		account := r.PathValue("org")
+		if user {
+			account = r.PathValue("user")
+		}
+		s.findInstallation(w, appID, func(installation *Installation) bool {
+			return installation.User == user && strings.EqualFold(installation.Account, account)
+		})
+	}
+}
+
+// findInstallation writes the first installation of appID satisfying match.
+func (s *Server) findInstallation(w http.ResponseWriter, appID int64, match func(*Installation) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, installation := range s.installations {
+		if installation.AppID == appID && match(installation) {
+			writeJSON(w, http.StatusOK, installation.github())
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+// lookupInstallation returns the installation of appID identified by the
+// request path, writing an error response if there is none.
+func (s *Server) lookupInstallation(w http.ResponseWriter, r *http.Request, appID int64) (*Installation, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+
+	s.mu.Lock()
+	installation, ok := s.installations[id]
+	s.mu.Unlock()
+
+	if !ok || installation.AppID != appID {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return nil, false
+	}
+	return installation, true
+}
+
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request, appID int64) {
+	installation, ok := s.lookupInstallation(w, r, appID)
+	if !ok {
+		return
+	}
+
+	var options github.InstallationTokenOptions
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+			writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+			return
+		}
+	}
+
+	permissions := installation.Permissions
+	if requested := permission.FromInstallationPermissions(options.Permissions); len(requested) > 0 {
+		for name, level := range requested {
+			if installation.Permissions[name].Rank() < level.Rank() {
+				writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("The permissions requested are not granted to this installation: %s=%s", name, level))
+				return
+			}
+		}
+		permissions = requested
+	}
+
+	var repositories []Repository
+	for _, name := range options.Repositories {
+		i := slices.IndexFunc(installation.Repositories, func(r Repository) bool { return strings.EqualFold(r.Name, name) })
+		if i < 0 {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("There is at least one repository that does not exist or is not accessible to the parent installation: %s", name))
+			return
+		}
+		repositories = appendRepository(repositories, installation.Repositories[i])
+	}
+	for _, id := range options.RepositoryIDs {
+		i := slices.IndexFunc(installation.Repositories, func(r Repository) bool { return r.ID == id })
+		if i < 0 {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("There is at least one repository that does not exist or is not accessible to the parent installation: %d", id))
+			return
+		}
+		repositories = appendRepository(repositories, installation.Repositories[i])
+	}
+
+	token := &Token{
+		Token:          newTokenValue(),
+		InstallationID: installation.ID,
+		Permissions:    permissions,
+		Repositories:   repositories,
+		ExpiresAt:      time.Now().Add(TokenLifetime).Truncate(time.Second),
+	}
+
+	s.mu.Lock()
+	s.tokens[token.Token] = token
+	s.mu.Unlock()
+
+	response := &github.InstallationToken{
+		Token:       github.Ptr(token.Token),
+		ExpiresAt:   &github.Timestamp{Time: token.ExpiresAt},
+		Permissions: permissions.InstallationPermissions(),
+	}
+	for _, repository := range repositories {
+		response.Repositories = append(response.Repositories, repository.github(installation.Account))
+	}
+
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (s *Server) listRepositories(w http.ResponseWriter, r *http.Request, token *Token) {
+	s.mu.Lock()
+	installation := s.installations[token.InstallationID]
+	s.mu.Unlock()
+
+	account, repositories := installation.Account, token.Repositories
+	if repositories == nil {
+		repositories = installation.Repositories
+	}
+
+	all := make([]*github.Repository, 0, len(repositories))
+	for _, repository := range repositories {
+		all = append(all, repository.github(account))
+	}
+
+	page := paginate(w, r, all)
+	writeJSON(w, http.StatusOK, &github.ListRepositories{
+		TotalCount:   github.Ptr(len(all)),
+		Repositories: page,
+	})
+}
+
+func (s *Server) revokeToken(w http.ResponseWriter, _ *http.Request, token *Token) {
+	s.mu.Lock()
+	token.Revoked = true
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// github returns the API representation of the installation.
+func (i *Installation) github() *github.Installation {
+	accountType := "Organization"
+	if i.User {
+		accountType = "User"
+	}
+	return &github.Installation{
+		ID:                  github.Ptr(i.ID),
+		AppID:               github.Ptr(i.AppID),
+		Account:             &github.User{Login: github.Ptr(i.Account), Type: github.Ptr(accountType)},
+		Permissions:         i.Permissions.InstallationPermissions(),
+		RepositorySelection: github.Ptr("selected"),
+	}
+}
+
+// github returns the API representation of the repository.
+func (r Repository) github(owner string) *github.Repository {
+	return &github.Repository{
+		ID:       github.Ptr(r.ID),
+		Name:     github.Ptr(r.Name),
+		FullName: github.Ptr(owner + "/" + r.Name),
+		Owner:    &github.User{Login: github.Ptr(owner)},
+		Topics:   r.Topics,
+	}
+}
+
+// paginate returns the page of items selected by the page and per_page query
+// parameters of r, setting a Link header if further pages remain.
+func paginate[T any](w http.ResponseWriter, r *http.Request, items []T) []T {
+	query := r.URL.Query()
+	perPage, _ := strconv.Atoi(query.Get("per_page"))
+	if perPage <= 0 || perPage > 100 {
+		perPage = 30
+	}
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+
+	if end < len(items) {
+		next := *r.URL
+		query.Set("page", strconv.Itoa(page+1))
+		query.Set("per_page", strconv.Itoa(perPage))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	return items[start:end]
+}
+
+func appendRepository(repositories []Repository, repository Repository) []Repository {
+	if slices.ContainsFunc(repositories, func(r Repository) bool { return r.ID == repository.ID }) {
+		return repositories
+	}
+	return append(repositories, repository)
+}
+
+func newTokenValue() string {
+	b := make([]byte, 18)
+	_, _ = rand.Read(b)
+	return "ghs_" + hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
@@ -0,0 +1,167 @@
+// Package metrics exposes the activity of ghait instances as Prometheus metrics.
+//
+// No cache hit ratio is reported, as ghait caches no tokens: every token
+// request is served by GitHub.
+package metrics
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/isometry/ghait"
+)
+
+// Source is implemented by ghait instances.
+type Source interface {
+	Stats() ghait.Stats
+}
+
+var (
+	tokensIssuedDesc = prometheus.NewDesc(
+		"ghait_tokens_issued_total",
+		"Number of installation tokens issued.",
+		[]string{"app_id", "provider", "installation_id", "profile"}, nil,
+	)
+	tokenErrorsDesc = prometheus.NewDesc(
+		"ghait_token_errors_total",
+		"Number of failed installation token requests, by error class.",
+		[]string{"app_id", "provider", "class"}, nil,
+	)
+	signDurationDesc = prometheus.NewDesc(
+		"ghait_sign_duration_seconds",
+		"Duration of provider signing operations.",
+		[]string{"app_id", "provider"}, nil,
+	)
+	rateLimitDesc = prometheus.NewDesc(
+		"ghait_github_rate_limit",
+		"GitHub primary rate limit, as last observed.",
+		[]string{"app_id", "provider"}, nil,
+	)
+	rateLimitRemainingDesc = prometheus.NewDesc(
+		"ghait_github_rate_limit_remaining",
+		"GitHub primary rate limit remaining, as last observed.",
+		[]string{"app_id", "provider"}, nil,
+	)
+	rateLimitResetDesc = prometheus.NewDesc(
+		"ghait_github_rate_limit_reset_timestamp_seconds",
+		"Time at which the GitHub primary rate limit resets, as last observed.",
+		[]string{"app_id", "provider"}, nil,
+	)
+)
+
+// Collector is a prometheus.Collector reporting the Stats of ghait instances.
+type Collector struct {
+	sources []Source
+}
+
+// NewCollector returns a Collector for the given ghait instances.
+func NewCollector(sources ...Source) *Collector {
+	return &Collector{sources: sources}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tokensIssuedDesc
+	ch <- tokenErrorsDesc
+	ch <- signDurationDesc
+	ch <- rateLimitDesc
+	ch <- rateLimitRemainingDesc
+	ch <- rateLimitResetDesc
+}
+
+// Collect implements prometheus.Collector. The stats of sources sharing an
+// app ID and provider, such as instances for different installations, are
+// summed, their series being indistinguishable.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, stats := range merge(c.sources) {
+		appID := strconv.FormatInt(stats.AppID, 10)
+
+		for key, count := range stats.TokensIssued {
+			ch <- prometheus.MustNewConstMetric(tokensIssuedDesc, prometheus.CounterValue, float64(count),
+				appID, stats.Provider, strconv.FormatInt(key.InstallationID, 10), key.Profile)
+		}
+
+		ch <- prometheus.MustNewConstMetric(tokenErrorsDesc, prometheus.CounterValue, float64(stats.FatalErrors),
+			appID, stats.Provider, "fatal")
+		ch <- prometheus.MustNewConstMetric(tokenErrorsDesc, prometheus.CounterValue, float64(stats.TransientErrors),
+			appID, stats.Provider, "transient")
+
+		buckets := make(map[float64]uint64, len(ghait.SignLatencyBuckets))
+		for i, bound := range ghait.SignLatencyBuckets {
+			buckets[bound] = stats.SignLatency.Buckets[i]
+		}
+		ch <- prometheus.MustNewConstHistogram(signDurationDesc,
+			stats.SignLatency.Count, stats.SignLatency.Sum.Seconds(), buckets,
+			appID, stats.Provider)
+
+		if rate := stats.RateLimit; rate.Limit > 0 {
+			ch <- prometheus.MustNewConstMetric(rateLimitDesc, prometheus.GaugeValue, float64(rate.Limit),
+				appID, stats.Provider)
+			ch <- prometheus.MustNewConstMetric(rateLimitRemainingDesc, prometheus.GaugeValue, float64(rate.Remaining),
+				appID, stats.Provider)
+			ch <- prometheus.MustNewConstMetric(rateLimitResetDesc, prometheus.GaugeValue, float64(rate.Reset.Unix()),
+				appID, stats.Provider)
+		}
+	}
+}
+
+type sourceKey struct {
+	appID    int64
+	provider string
+}
+
+// merge returns the stats of sources, summed by app ID and provider. Of the
+// rate limits observed for an app, that of the latest window with the
+// fewest requests remaining is kept.
+func merge(sources []Source) []ghait.Stats {
+	var merged []ghait.Stats
+	index := map[sourceKey]int{}
+	for _, source := range sources {
+		stats := source.Stats()
+		key := sourceKey{appID: stats.AppID, provider: stats.Provider}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			stats.TokensIssued = maps.Clone(stats.TokensIssued)
+			stats.SignLatency.Buckets = slices.Clone(stats.SignLatency.Buckets)
+			merged = append(merged, stats)
+			continue
+		}
+
+		m := &merged[i]
+		if m.TokensIssued == nil {
+			m.TokensIssued = map[ghait.TokenKey]uint64{}
+		}
+		for key, count := range stats.TokensIssued {
+			m.TokensIssued[key] += count
+		}
+		m.FatalErrors += stats.FatalErrors
+		m.TransientErrors += stats.TransientErrors
+		m.SignLatency.Count += stats.SignLatency.Count
+		m.SignLatency.Sum += stats.SignLatency.Sum
+		for j, count := range stats.SignLatency.Buckets {
+			if j < len(m.SignLatency.Buckets) {
+				m.SignLatency.Buckets[j] += count
+			}
+		}
+		rate, last := stats.RateLimit, m.RateLimit
+		if rate.Limit > 0 && (last.Limit == 0 || rate.Reset.After(last.Reset.Time) ||
+			rate.Reset.Equal(last.Reset) && rate.Remaining < last.Remaining) {
+			m.RateLimit = rate
+		}
+	}
+	return merged
+}
+
+// Handler returns an http.Handler serving the metrics of the given ghait
+// instances, for example at "/metrics".
+func Handler(sources ...Source) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCollector(sources...))
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,206 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait"
+	"github.com/isometry/ghait/metrics"
+)
+
+type source ghait.Stats
+
+func (s source) Stats() ghait.Stats {
+	return ghait.Stats(s)
+}
+
+func newSource() source {
+	buckets := make([]uint64, len(ghait.SignLatencyBuckets))
+	for i, bound := range ghait.SignLatencyBuckets {
+		if bound >= .05 {
+			buckets[i] = 2
+		} else if bound >= .01 {
+			buckets[i] = 1
+		}
+	}
+
+	return source{
+		AppID:    12345,
+		Provider: "file",
+		TokensIssued: map[ghait.TokenKey]uint64{
+			{InstallationID: 67890}:                3,
+			{InstallationID: 67890, Profile: "ci"}: 1,
+		},
+		FatalErrors:     2,
+		TransientErrors: 1,
+		SignLatency: ghait.Histogram{
+			Count:   2,
+			Sum:     60 * time.Millisecond,
+			Buckets: buckets,
+		},
+		RateLimit: github.Rate{Limit: 5000, Remaining: 4990, Reset: github.Timestamp{Time: time.Unix(1700000000, 0)}},
+	}
+}
+
+func TestCollector(t *testing.T) {
+	expected := `
+# HELP ghait_github_rate_limit GitHub primary rate limit, as last observed.
+# TYPE ghait_github_rate_limit gauge
+ghait_github_rate_limit{app_id="12345",provider="file"} 5000
+# HELP ghait_github_rate_limit_remaining GitHub primary rate limit remaining, as last observed.
+# TYPE ghait_github_rate_limit_remaining gauge
+ghait_github_rate_limit_remaining{app_id="12345",provider="file"} 4990
+# HELP ghait_github_rate_limit_reset_timestamp_seconds Time at which the GitHub primary rate limit resets, as last observed.
+# TYPE ghait_github_rate_limit_reset_timestamp_seconds gauge
+ghait_github_rate_limit_reset_timestamp_seconds{app_id="12345",provider="file"} 1.7e+09
+# HELP ghait_token_errors_total Number of failed installation token requests, by error class.
+# TYPE ghait_token_errors_total counter
+ghait_token_errors_total{app_id="12345",class="fatal",provider="file"} 2
+ghait_token_errors_total{app_id="12345",class="transient",provider="file"} 1
+# HELP ghait_tokens_issued_total Number of installation tokens issued.
+# TYPE ghait_tokens_issued_total counter
+ghait_tokens_issued_total{app_id="12345",installation_id="67890",profile="",provider="file"} 3
+ghait_tokens_issued_total{app_id="12345",installation_id="67890",profile="ci",provider="file"} 1
+`
+	collector := metrics.NewCollector(newSource())
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"ghait_github_rate_limit",
+		"ghait_github_rate_limit_remaining",
+		"ghait_github_rate_limit_reset_timestamp_seconds",
+		"ghait_token_errors_total",
+		"ghait_tokens_issued_total",
+	))
+
+	problems, err := testutil.CollectAndLint(collector)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestCollector_SignDuration(t *testing.T) {
+	expected := `
+# HELP ghait_sign_duration_seconds Duration of provider signing operations.
+# TYPE ghait_sign_duration_seconds histogram
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.005"} 0
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.01"} 1
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.025"} 1
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.05"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.1"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.25"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.5"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="1"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="2.5"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="5"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="10"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="+Inf"} 2
+ghait_sign_duration_seconds_sum{app_id="12345",provider="file"} 0.06
+ghait_sign_duration_seconds_count{app_id="12345",provider="file"} 2
+`
+	collector := metrics.NewCollector(newSource())
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "ghait_sign_duration_seconds"))
+}
+
+func TestCollector_UnknownRateLimit(t *testing.T) {
+	s := newSource()
+	s.RateLimit = github.Rate{}
+
+	// the rate limit is not reported until observed
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.NewCollector(s), "ghait_github_rate_limit_remaining"))
+	assert.Equal(t, 2, testutil.CollectAndCount(metrics.NewCollector(s), "ghait_token_errors_total"))
+}
+
+func TestHandler(t *testing.T) {
+	server := httptest.NewServer(metrics.Handler(newSource()))
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `ghait_tokens_issued_total{app_id="12345",installation_id="67890",profile="ci",provider="file"} 1`)
+	assert.Contains(t, string(body), `ghait_sign_duration_seconds_count{app_id="12345",provider="file"} 2`)
+}
+
+func TestCollector_MultipleSources(t *testing.T) {
+	other := newSource()
+	other.TokensIssued = map[ghait.TokenKey]uint64{
+		{InstallationID: 67890}: 2,
+		{InstallationID: 13579}: 1,
+	}
+	other.RateLimit.Remaining = 4980
+
+	unrelated := newSource()
+	unrelated.AppID = 54321
+	unrelated.RateLimit = github.Rate{}
+
+	expected := `
+# HELP ghait_github_rate_limit_remaining GitHub primary rate limit remaining, as last observed.
+# TYPE ghait_github_rate_limit_remaining gauge
+ghait_github_rate_limit_remaining{app_id="12345",provider="file"} 4980
+# HELP ghait_sign_duration_seconds Duration of provider signing operations.
+# TYPE ghait_sign_duration_seconds histogram
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.005"} 0
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.01"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.025"} 2
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.05"} 4
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.1"} 4
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.25"} 4
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="0.5"} 4
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="1"} 4
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="2.5"} 4
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="5"} 4
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="10"} 4
+ghait_sign_duration_seconds_bucket{app_id="12345",provider="file",le="+Inf"} 4
+ghait_sign_duration_seconds_sum{app_id="12345",provider="file"} 0.12
+ghait_sign_duration_seconds_count{app_id="12345",provider="file"} 4
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="0.005"} 0
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="0.01"} 1
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="0.025"} 1
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="0.05"} 2
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="0.1"} 2
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="0.25"} 2
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="0.5"} 2
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="1"} 2
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="2.5"} 2
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="5"} 2
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="10"} 2
+ghait_sign_duration_seconds_bucket{app_id="54321",provider="file",le="+Inf"} 2
+ghait_sign_duration_seconds_sum{app_id="54321",provider="file"} 0.06
+ghait_sign_duration_seconds_count{app_id="54321",provider="file"} 2
+# HELP ghait_token_errors_total Number of failed installation token requests, by error class.
+# TYPE ghait_token_errors_total counter
+ghait_token_errors_total{app_id="12345",class="fatal",provider="file"} 4
+ghait_token_errors_total{app_id="12345",class="transient",provider="file"} 2
+ghait_token_errors_total{app_id="54321",class="fatal",provider="file"} 2
+ghait_token_errors_total{app_id="54321",class="transient",provider="file"} 1
+# HELP ghait_tokens_issued_total Number of installation tokens issued.
+# TYPE ghait_tokens_issued_total counter
+ghait_tokens_issued_total{app_id="12345",installation_id="13579",profile="",provider="file"} 1
+ghait_tokens_issued_total{app_id="12345",installation_id="67890",profile="",provider="file"} 5
+ghait_tokens_issued_total{app_id="12345",installation_id="67890",profile="ci",provider="file"} 1
+ghait_tokens_issued_total{app_id="54321",installation_id="67890",profile="",provider="file"} 3
+ghait_tokens_issued_total{app_id="54321",installation_id="67890",profile="ci",provider="file"} 1
+`
+	source := newSource()
+	collector := metrics.NewCollector(source, other, unrelated)
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"ghait_github_rate_limit_remaining",
+		"ghait_sign_duration_seconds",
+		"ghait_token_errors_total",
+		"ghait_tokens_issued_total",
+	))
+
+	// sources are left as they were
+	assert.Equal(t, newSource(), source)
+}
@@ -0,0 +1,84 @@
+package ghait
+
+import (
+	"log/slog"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/isometry/ghait/audit"
+	"github.com/isometry/ghait/policy"
+	"github.com/isometry/ghait/provider"
+)
+
+// Option configures optional behaviour of a ghait instance.
+type Option func(*ghait)
+
+// WithPolicy configures a policy that every token request must satisfy
+// before it is sent to GitHub.
+func WithPolicy(p policy.Policy) Option {
+	return func(g *ghait) {
+		g.policy = p
+	}
+}
+
+// WithLogger configures structured logging of signer selection, signing and
+// token requests. Tokens themselves are never logged. By default, nothing is
+// logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(g *ghait) {
+		if logger != nil {
+			g.logger = logger
+		}
+	}
+}
+
+// WithTracerProvider enables OpenTelemetry tracing of token requests, with
+// child spans for provider signing and GitHub API requests.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(g *ghait) {
+		g.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider enables OpenTelemetry metrics for issued tokens, token
+// errors by class and provider signing latency.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(g *ghait) {
+		g.meterProvider = mp
+	}
+}
+
+// WithAuditSink configures a sink recording every token request, whether
+// successful or not. Failure to record an event is logged, but does not
+// fail the token request.
+func WithAuditSink(sink audit.Sink) Option {
+	return func(g *ghait) {
+		g.auditSink = sink
+	}
+}
+
+// WithRateLimitPolicy configures pre-emptive throttling of token requests
+// when the GitHub primary rate limit remaining drops to a threshold, in
+// addition to the handling of secondary rate limits.
+func WithRateLimitPolicy(rp RateLimitPolicy) Option {
+	return func(g *ghait) {
+		g.rateLimitPolicy = rp
+	}
+}
+
+// WithSigner configures the provider used to sign GitHub App JWTs directly,
+// bypassing the provider registry and the provider and key of the Config.
+func WithSigner(signer provider.Provider) Option {
+	return func(g *ghait) {
+		g.signer = signer
+	}
+}
+
+// WithBaseURL configures the base URL of the GitHub API, for GitHub
+// Enterprise Server or test servers.
+func WithBaseURL(baseURL string) Option {
+	return func(g *ghait) {
+		g.baseURL = baseURL
+	}
+}
@@ -0,0 +1,275 @@
+// Package permission provides helpers for working with GitHub App installation permissions.
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v80/github"
+)
+
+// Level is a GitHub App permission access level.
+type Level string
+
+const (
+	None  Level = ""
+	Read  Level = "read"
+	Write Level = "write"
+	Admin Level = "admin"
+)
+
+// Rank returns the relative strength of the level, or -1 if the level is unknown.
+func (l Level) Rank() int {
+	switch l {
+	case None:
+		return 0
+	case Read:
+		return 1
+	case Write:
+		return 2
+	case Admin:
+		return 3
+	default:
+		return -1
+	}
+}
+
+// Valid reports whether l is a known, non-empty access level.
+func (l Level) Valid() bool {
+	return l.Rank() > 0
+}
+
+// Set maps permission names, as used by the GitHub API, to access levels.
+type Set map[string]Level
+
+// fields maps each permission name to its field index within github.InstallationPermissions.
+var fields = func() map[string]int {
+	t := reflect.TypeOf(github.InstallationPermissions{})
+	m := make(map[string]int, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			m[name] = i
+		}
+	}
+	return m
+}()
+
+// Names returns the sorted names of all permissions known to github.InstallationPermissions.
+func Names() []string {
+	return slices.Sorted(maps.Keys(fields))
+}
+
+// Known reports whether name is a permission known to github.InstallationPermissions.
+func Known(name string) bool {
+	_, ok := fields[name]
+	return ok
+}
+
+// FromInstallationPermissions converts p into a Set, omitting unset permissions.
+func FromInstallationPermissions(p *github.InstallationPermissions) Set {
+	s := Set{}
+	if p == nil {
+		return s
+	}
+
+	v := reflect.ValueOf(p).Elem()
+	for name, i := range fields {
+		if f := v.Field(i); !f.IsNil() {
+			s[name] = Level(f.Elem().String())
+		}
+	}
+	return s
+}
+
+// InstallationPermissions converts s into a github.InstallationPermissions,
+// silently ignoring unknown permission names.
+func (s Set) InstallationPermissions() *github.InstallationPermissions {
+	p := &github.InstallationPermissions{}
+	v := reflect.ValueOf(p).Elem()
+	for name, level := range s {
+		i, ok := fields[name]
+		if !ok || level == None {
+			continue
+		}
+		v.Field(i).Set(reflect.ValueOf(github.Ptr(string(level))))
+	}
+	return p
+}
+
+// levels holds the access levels that may be requested for each permission,
+// as enumerated by the app-permissions schema of the GitHub REST API.
+// Permissions absent from the table, such as any added to
+// github.InstallationPermissions since, default to read and write.
+var levels = map[string][]Level{
+	// repository permissions
+	"actions":                      {Read, Write},
+	"actions_variables":            {Read, Write},
+	"administration":               {Read, Write},
+	"attestations":                 {Read, Write},
+	"checks":                       {Read, Write},
+	"codespaces":                   {Read, Write},
+	"codespaces_lifecycle_admin":   {Read, Write},
+	"codespaces_metadata":          {Read},
+	"codespaces_secrets":           {Read, Write},
+	"content_references":           {Read, Write},
+	"contents":                     {Read, Write},
+	"dependabot_secrets":           {Read, Write},
+	"deployments":                  {Read, Write},
+	"discussions":                  {Read, Write},
+	"environments":                 {Read, Write},
+	"issues":                       {Read, Write},
+	"merge_queues":                 {Read, Write},
+	"metadata":                     {Read},
+	"packages":                     {Read, Write},
+	"pages":                        {Read, Write},
+	"pull_requests":                {Read, Write},
+	"repository_advisories":        {Read, Write},
+	"repository_custom_properties": {Read, Write},
+	"repository_hooks":             {Read, Write},
+	"repository_pre_receive_hooks": {Read, Write},
+	"repository_projects":          {Read, Write, Admin},
+	"secret_scanning_alerts":       {Read, Write},
+	"secrets":                      {Read, Write},
+	"security_events":              {Read, Write},
+	"single_file":                  {Read, Write},
+	"statuses":                     {Read, Write},
+	"vulnerability_alerts":         {Read, Write},
+	"workflows":                    {Write},
+
+	// organization permissions
+	"members":                                     {Read, Write},
+	"organization_actions_variables":              {Read, Write},
+	"organization_administration":                 {Read, Write},
+	"organization_announcement_banners":           {Read, Write},
+	"organization_api_insights":                   {Read},
+	"organization_codespaces":                     {Read, Write},
+	"organization_codespaces_secrets":             {Read, Write},
+	"organization_codespaces_settings":            {Read, Write},
+	"organization_copilot_seat_management":        {Write},
+	"organization_custom_org_roles":               {Read, Write},
+	"organization_custom_properties":              {Read, Write, Admin},
+	"organization_custom_roles":                   {Read, Write},
+	"organization_dependabot_secrets":             {Read, Write},
+	"organization_events":                         {Read},
+	"organization_hooks":                          {Read, Write},
+	"organization_knowledge_bases":                {Read, Write},
+	"organization_packages":                       {Read, Write},
+	"organization_personal_access_token_requests": {Read, Write},
+	"organization_personal_access_tokens":         {Read, Write},
+	"organization_plan":                           {Read},
+	"organization_pre_receive_hooks":              {Read, Write},
+	"organization_projects":                       {Read, Write, Admin},
+	"organization_secrets":                        {Read, Write},
+	"organization_self_hosted_runners":            {Read, Write},
+	"organization_user_blocking":                  {Read, Write},
+	"team_discussions":                            {Read, Write},
+
+	// account permissions
+	"blocking":                    {Read, Write},
+	"codespaces_user_secrets":     {Read, Write},
+	"copilot_messages":            {Read},
+	"emails":                      {Read, Write},
+	"followers":                   {Read, Write},
+	"gists":                       {Write},
+	"git_signing_ssh_public_keys": {Read, Write},
+	"gpg_keys":                    {Read, Write},
+	"interaction_limits":          {Read, Write},
+	"keys":                        {Read, Write},
+	"plan":                        {Read},
+	"profile":                     {Write},
+	"starring":                    {Read, Write},
+	"user_events":                 {Read},
+	"watching":                    {Read, Write},
+}
+
+// Levels returns the access levels that may be requested for the named
+// permission, or nil if the permission is unknown.
+func Levels(name string) []Level {
+	if !Known(name) {
+		return nil
+	}
+	if l, ok := levels[name]; ok {
+		return slices.Clone(l)
+	}
+	return []Level{Read, Write}
+}
+
+// Validate checks that name is a known permission and level is allowed for
+// it, suggesting the nearest valid alternative otherwise.
+func Validate(name string, level Level) error {
+	if !Known(name) {
+		if suggestion := nearest(name, Names()); suggestion != "" {
+			return fmt.Errorf("unknown permission %q (did you mean %q?)", name, suggestion)
+		}
+		return fmt.Errorf("unknown permission %q", name)
+	}
+
+	allowed := Levels(name)
+	if !slices.Contains(allowed, level) {
+		names := make([]string, len(allowed))
+		for i, l := range allowed {
+			names[i] = string(l)
+		}
+		if suggestion := nearest(string(level), names); suggestion != "" {
+			return fmt.Errorf("invalid level %q for permission %q (did you mean %q?)", level, name, suggestion)
+		}
+		return fmt.Errorf("invalid level %q for permission %q (allowed: %s)", level, name, strings.Join(names, ","))
+	}
+
+	return nil
+}
+
+// Parse validates a map of permission names to levels, such as provided on
+// the command line, and converts it into a Set.
+func Parse(m map[string]string) (Set, error) {
+	s := make(Set, len(m))
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(m)) {
+		level := Level(strings.ToLower(strings.TrimSpace(m[name])))
+		name = strings.ToLower(strings.TrimSpace(name))
+		if err := Validate(name, level); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		s[name] = level
+	}
+	return s, errors.Join(errs...)
+}
+
+// nearest returns the candidate closest to s by edit distance, provided it
+// is close enough to plausibly be a typo.
+func nearest(s string, candidates []string) string {
+	best, bestDistance := "", len(s)/2+1
+	for _, c := range candidates {
+		if d := distance(s, c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
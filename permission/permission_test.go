@@ -0,0 +1,119 @@
+package permission_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/permission"
+)
+
+func TestParse(t *testing.T) {
+	s, err := permission.Parse(map[string]string{
+		"contents":      "read",
+		"Pull_Requests": "WRITE",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, permission.Set{"contents": permission.Read, "pull_requests": permission.Write}, s)
+
+	p := s.InstallationPermissions()
+	assert.Equal(t, "read", p.GetContents())
+	assert.Equal(t, "write", p.GetPullRequests())
+	assert.Equal(t, s, permission.FromInstallationPermissions(p))
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		input    map[string]string
+		expected string
+	}{
+		"typo in name":   {map[string]string{"content": "read"}, `unknown permission "content" (did you mean "contents"?)`},
+		"typo in level":  {map[string]string{"contents": "reed"}, `invalid level "reed" for permission "contents" (did you mean "read"?)`},
+		"unknown name":   {map[string]string{"everything": "read"}, `unknown permission "everything"`},
+		"disallowed":     {map[string]string{"metadata": "write"}, `invalid level "write" for permission "metadata" (allowed: read)`},
+		"admin disallow": {map[string]string{"issues": "admin"}, `invalid level "admin" for permission "issues" (allowed: read,write)`},
+		"write only":     {map[string]string{"workflows": "read"}, `invalid level "read" for permission "workflows" (allowed: write)`},
+		"read only":      {map[string]string{"organization_plan": "write"}, `invalid level "write" for permission "organization_plan" (allowed: read)`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := permission.Parse(tt.input)
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := permission.Names()
+	assert.Contains(t, names, "contents")
+	assert.Contains(t, names, "pull_requests")
+	assert.IsIncreasing(t, names)
+
+	assert.Equal(t, []permission.Level{permission.Read}, permission.Levels("metadata"))
+	assert.Nil(t, permission.Levels("nope"))
+	assert.True(t, permission.Known("workflows"))
+	assert.False(t, permission.Known("workflow"))
+}
+
+func TestLevels(t *testing.T) {
+	r, w, a := permission.Read, permission.Write, permission.Admin
+	tests := map[string][]permission.Level{
+		"contents":                             {r, w},
+		"metadata":                             {r},
+		"workflows":                            {w},
+		"profile":                              {w},
+		"gists":                                {w},
+		"organization_copilot_seat_management": {w},
+		"organization_custom_properties":       {r, w, a},
+		"organization_projects":                {r, w, a},
+		"repository_projects":                  {r, w, a},
+		"organization_events":                  {r},
+		"organization_plan":                    {r},
+		"organization_api_insights":            {r},
+		"codespaces_metadata":                  {r},
+		"copilot_messages":                     {r},
+		"plan":                                 {r},
+		"user_events":                          {r},
+	}
+
+	for name, expected := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, expected, permission.Levels(name))
+		})
+	}
+
+	s, err := permission.Parse(map[string]string{"workflows": "write", "organization_custom_properties": "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, "admin", s.InstallationPermissions().GetOrganizationCustomProperties())
+}
+
+func TestResolve(t *testing.T) {
+	s, err := permission.Resolve(
+		[]string{permission.ScopeReadOnly, permission.ScopeRelease},
+		permission.Set{"metadata": permission.Read, "issues": permission.Write},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "contents=write,issues=write,metadata=read", s.String())
+
+	_, err = permission.Resolve([]string{"read-onyl"}, nil)
+	assert.EqualError(t, err, `unknown scope "read-onyl" (did you mean "read-only"?)`)
+}
+
+func TestRegisterScope(t *testing.T) {
+	require.NoError(t, permission.RegisterScope("docs", permission.Set{"pages": permission.Write}))
+	assert.Contains(t, permission.Scopes(), "docs")
+
+	s, ok := permission.Scope("docs")
+	require.True(t, ok)
+	assert.Equal(t, permission.Set{"pages": permission.Write}, s)
+
+	assert.Error(t, permission.RegisterScope("bad", permission.Set{"pages": "admin"}))
+
+	err := permission.RegisterScope(permission.ScopeReadOnly, permission.Set{"contents": permission.Write})
+	assert.EqualError(t, err, `scope "read-only" is built-in and cannot be redefined`)
+	s, ok = permission.Scope(permission.ScopeReadOnly)
+	require.True(t, ok)
+	assert.Equal(t, permission.Read, s["contents"])
+}
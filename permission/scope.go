@@ -0,0 +1,133 @@
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Built-in scopes, each naming a preset permission set.
+const (
+	// ScopeReadOnly grants read access to repository contents.
+	ScopeReadOnly = "read-only"
+	// ScopeCI grants access typically needed to report CI results.
+	ScopeCI = "ci"
+	// ScopeRelease grants access typically needed to publish releases.
+	ScopeRelease = "release"
+	// ScopePRBot grants access typically needed to open and update pull requests.
+	ScopePRBot = "pr-bot"
+)
+
+var (
+	scopes = map[string]Set{
+		ScopeReadOnly: {
+			"contents": Read,
+			"metadata": Read,
+		},
+		ScopeCI: {
+			"actions":  Read,
+			"checks":   Write,
+			"contents": Read,
+			"metadata": Read,
+			"statuses": Write,
+		},
+		ScopeRelease: {
+			"contents": Write,
+			"metadata": Read,
+		},
+		ScopePRBot: {
+			"contents":      Write,
+			"issues":        Write,
+			"metadata":      Read,
+			"pull_requests": Write,
+		},
+	}
+	scopesMu sync.RWMutex
+)
+
+// RegisterScope registers a named permission preset, replacing any existing
+// user-defined scope of the same name. The names of the built-in scopes are
+// reserved.
+func RegisterScope(name string, s Set) error {
+	if name == "" {
+		return errors.New("empty scope name")
+	}
+	if builtin(name) {
+		return fmt.Errorf("scope %q is built-in and cannot be redefined", name)
+	}
+	for perm, level := range s {
+		if err := Validate(perm, level); err != nil {
+			return fmt.Errorf("scope %q: %w", name, err)
+		}
+	}
+
+	scopesMu.Lock()
+	defer scopesMu.Unlock()
+
+	scopes[name] = maps.Clone(s)
+	return nil
+}
+
+// builtin reports whether name is the name of a built-in scope.
+func builtin(name string) bool {
+	switch name {
+	case ScopeReadOnly, ScopeCI, ScopeRelease, ScopePRBot:
+		return true
+	}
+	return false
+}
+
+// Scopes returns the sorted names of all registered scopes.
+func Scopes() []string {
+	scopesMu.RLock()
+	defer scopesMu.RUnlock()
+
+	return slices.Sorted(maps.Keys(scopes))
+}
+
+// Scope returns the permission set of the named scope.
+func Scope(name string) (Set, bool) {
+	scopesMu.RLock()
+	defer scopesMu.RUnlock()
+
+	s, ok := scopes[name]
+	return maps.Clone(s), ok
+}
+
+// Resolve combines the named scopes, taking the highest level of each
+// permission, then applies the explicit overrides, which take precedence.
+func Resolve(names []string, overrides Set) (Set, error) {
+	s := Set{}
+	for _, name := range names {
+		scope, ok := Scope(name)
+		if !ok {
+			if suggestion := nearest(name, Scopes()); suggestion != "" {
+				return nil, fmt.Errorf("unknown scope %q (did you mean %q?)", name, suggestion)
+			}
+			return nil, fmt.Errorf("unknown scope %q", name)
+		}
+		for perm, level := range scope {
+			if level.Rank() > s[perm].Rank() {
+				s[perm] = level
+			}
+		}
+	}
+
+	maps.Copy(s, overrides)
+
+	return s, nil
+}
+
+// String returns the set in the "name=level,..." form accepted on the command line.
+func (s Set) String() string {
+	var b []byte
+	for _, name := range slices.Sorted(maps.Keys(s)) {
+		if len(b) > 0 {
+			b = append(b, ',')
+		}
+		b = fmt.Appendf(b, "%s=%s", name, s[name])
+	}
+	return string(b)
+}
@@ -0,0 +1,112 @@
+package ghait
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-github/v80/github"
+
+	"github.com/isometry/ghait/permission"
+	"github.com/isometry/ghait/policy"
+)
+
+// applyPolicy evaluates the token request against the configured policy,
+// returning the effective (possibly downscoped) token options and the
+// policy decision.
+func (g *ghait) applyPolicy(ctx context.Context, installationID int64, options *github.InstallationTokenOptions) (*github.InstallationTokenOptions, policy.Decision, error) {
+	req := policy.Request{
+		Caller:         policy.CallerFromContext(ctx),
+		Profile:        policy.ProfileFromContext(ctx),
+		AppID:          g.appID,
+		InstallationID: installationID,
+	}
+	if options != nil {
+		req.Repositories = options.Repositories
+		req.RepositoryIDs = options.RepositoryIDs
+		req.Permissions = permission.FromInstallationPermissions(options.Permissions)
+	}
+
+	decision, err := g.policy.Evaluate(ctx, req)
+	if err != nil {
+		return nil, decision, fmt.Errorf("evaluate policy: %w", err)
+	}
+
+	if !decision.Allowed {
+		return nil, decision, &policy.DeniedError{Reason: decision.Reason}
+	}
+
+	effective, err := narrow(options, decision)
+	if err != nil {
+		return nil, decision, err
+	}
+
+	return effective, decision, nil
+}
+
+// narrow returns the requested token options narrowed by the restrictions
+// of decision, which never widen them: a nil restriction keeps the request,
+// and a restriction of a restricted request is intersected with it.
+func narrow(options *github.InstallationTokenOptions, decision policy.Decision) (*github.InstallationTokenOptions, error) {
+	if options == nil {
+		options = &github.InstallationTokenOptions{}
+	}
+	effective := &github.InstallationTokenOptions{
+		Repositories:  options.Repositories,
+		RepositoryIDs: options.RepositoryIDs,
+		Permissions:   options.Permissions,
+	}
+
+	if decision.Repositories != nil || decision.RepositoryIDs != nil {
+		if len(options.Repositories) == 0 && len(options.RepositoryIDs) == 0 {
+			effective.Repositories = decision.Repositories
+			effective.RepositoryIDs = decision.RepositoryIDs
+		} else {
+			if decision.Repositories != nil {
+				effective.Repositories = intersect(options.Repositories, decision.Repositories)
+			}
+			if decision.RepositoryIDs != nil {
+				effective.RepositoryIDs = intersect(options.RepositoryIDs, decision.RepositoryIDs)
+			}
+			if len(effective.Repositories) == 0 && len(effective.RepositoryIDs) == 0 {
+				return nil, &policy.DeniedError{Reason: "no requested repository is permitted"}
+			}
+		}
+	}
+
+	if len(decision.Permissions) > 0 {
+		requested := permission.FromInstallationPermissions(options.Permissions)
+		if len(requested) == 0 {
+			effective.Permissions = decision.Permissions.InstallationPermissions()
+		} else {
+			permissions := permission.Set{}
+			for name, level := range requested {
+				limit, ok := decision.Permissions[name]
+				switch {
+				case !ok:
+				case level.Rank() > limit.Rank():
+					permissions[name] = limit
+				default:
+					permissions[name] = level
+				}
+			}
+			if len(permissions) == 0 {
+				return nil, &policy.DeniedError{Reason: "no requested permission is permitted"}
+			}
+			effective.Permissions = permissions.InstallationPermissions()
+		}
+	}
+
+	return effective, nil
+}
+
+// intersect returns the elements of requested also in allowed, in order.
+func intersect[T comparable](requested, allowed []T) []T {
+	var both []T
+	for _, v := range requested {
+		if slices.Contains(allowed, v) {
+			both = append(both, v)
+		}
+	}
+	return both
+}
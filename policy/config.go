@@ -0,0 +1,305 @@
+package policy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/isometry/ghait/permission"
+)
+
+// Mode controls how a request exceeding a profile is handled.
+type Mode string
+
+const (
+	// ModeEnforce rejects any request exceeding the profile.
+	ModeEnforce Mode = "enforce"
+	// ModeDownscope narrows requests exceeding the profile to conform to it.
+	ModeDownscope Mode = "downscope"
+)
+
+// Profile restricts the tokens that may be issued to matching callers.
+type Profile struct {
+	// Callers holds glob patterns matched against the request caller.
+	Callers []string `yaml:"callers"`
+	// Installations restricts the installation IDs that may be requested.
+	Installations []int64 `yaml:"installations"`
+	// Repositories holds glob patterns of the repository names that may be
+	// requested. Empty allows all repositories.
+	Repositories []string `yaml:"repositories"`
+	// Permissions holds the maximum level of each permission that may be
+	// requested. Empty allows all permissions.
+	Permissions map[string]permission.Level `yaml:"permissions"`
+	// AdvisoryLifetime is the lifetime within which issued tokens should be
+	// used, recorded in the audit trail. It is not enforced: the tokens
+	// remain valid at GitHub for their full lifetime.
+	AdvisoryLifetime time.Duration `yaml:"advisoryLifetime"`
+	// Mode overrides the policy-wide mode for this profile.
+	Mode Mode `yaml:"mode"`
+}
+
+// Config is a declarative Policy, typically loaded from YAML:
+//
+//	mode: enforce
+//	defaultProfile: read-only
+//	profiles:
+//	  read-only:
+//	    permissions:
+//	      contents: read
+//	      metadata: read
+//	  deploy:
+//	    callers: ["deploy-*"]
+//	    repositories: ["service-*"]
+//	    permissions:
+//	      contents: write
+//	      deployments: write
+//	    advisoryLifetime: 15m
+//	    mode: downscope
+type Config struct {
+	Mode           Mode                `yaml:"mode"`
+	DefaultProfile string              `yaml:"defaultProfile"`
+	Profiles       map[string]*Profile `yaml:"profiles"`
+}
+
+// Load reads and parses a YAML policy file.
+func Load(name string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses a YAML policy document.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate checks the policy for internal consistency.
+func (c *Config) Validate() error {
+	if err := validateMode(c.Mode); err != nil {
+		return err
+	}
+
+	if c.DefaultProfile != "" {
+		if _, ok := c.Profiles[c.DefaultProfile]; !ok {
+			return fmt.Errorf("default profile %q not defined", c.DefaultProfile)
+		}
+	}
+
+	for name, p := range c.Profiles {
+		if p == nil {
+			return fmt.Errorf("profile %q: empty definition", name)
+		}
+		if err := validateMode(p.Mode); err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+		for _, pattern := range slices.Concat(p.Callers, p.Repositories) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("profile %q: invalid pattern %q: %w", name, pattern, err)
+			}
+		}
+		for perm, level := range p.Permissions {
+			if err := permission.Validate(perm, level); err != nil {
+				return fmt.Errorf("profile %q: %w", name, err)
+			}
+		}
+		if p.AdvisoryLifetime < 0 {
+			return fmt.Errorf("profile %q: negative advisoryLifetime", name)
+		}
+	}
+
+	return nil
+}
+
+func validateMode(m Mode) error {
+	switch m {
+	case "", ModeEnforce, ModeDownscope:
+		return nil
+	default:
+		return fmt.Errorf("invalid mode %q", m)
+	}
+}
+
+// Evaluate implements Policy.
+func (c *Config) Evaluate(_ context.Context, req Request) (Decision, error) {
+	name, profile, err := c.profile(req)
+	if err != nil {
+		return Decision{Reason: err.Error()}, nil
+	}
+	if profile == nil {
+		if name != "" {
+			return deny("profile %q not defined", name), nil
+		}
+		return deny("no policy profile matches caller %q", req.Caller), nil
+	}
+
+	// an explicitly named profile is no way around its callers
+	if req.Profile != "" && len(profile.Callers) > 0 && !matchAny(profile.Callers, req.Caller) {
+		return deny("profile %q not permitted for caller %q", name, req.Caller), nil
+	}
+
+	mode := profile.Mode
+	if mode == "" {
+		mode = c.Mode
+	}
+	if mode == "" {
+		mode = ModeEnforce
+	}
+
+	if len(profile.Installations) > 0 && !slices.Contains(profile.Installations, req.InstallationID) {
+		return deny("profile %q: installation %d not permitted", name, req.InstallationID), nil
+	}
+
+	d := Decision{
+		Allowed:          true,
+		Profile:          name,
+		Repositories:     req.Repositories,
+		RepositoryIDs:    req.RepositoryIDs,
+		Permissions:      req.Permissions,
+		AdvisoryLifetime: profile.AdvisoryLifetime,
+	}
+	var notes []string
+
+	if len(profile.Repositories) > 0 {
+		if len(req.RepositoryIDs) > 0 {
+			return deny("profile %q: repository IDs cannot be matched against repository patterns", name), nil
+		}
+
+		if len(req.Repositories) == 0 {
+			literal := slices.IndexFunc(profile.Repositories, hasMeta) == -1
+			if mode != ModeDownscope || !literal {
+				return deny("profile %q: access to all repositories not permitted", name), nil
+			}
+			d.Repositories = slices.Clone(profile.Repositories)
+			notes = append(notes, "repositories limited to "+strings.Join(d.Repositories, ","))
+		} else {
+			var allowed, rejected []string
+			for _, repo := range req.Repositories {
+				if matchAny(profile.Repositories, repo) {
+					allowed = append(allowed, repo)
+				} else {
+					rejected = append(rejected, repo)
+				}
+			}
+			if len(rejected) > 0 {
+				if mode != ModeDownscope || len(allowed) == 0 {
+					return deny("profile %q: repositories not permitted: %s", name, strings.Join(rejected, ",")), nil
+				}
+				d.Repositories = allowed
+				notes = append(notes, "dropped repositories "+strings.Join(rejected, ","))
+			}
+		}
+	}
+
+	if len(profile.Permissions) > 0 {
+		if len(req.Permissions) == 0 {
+			if mode != ModeDownscope {
+				return deny("profile %q: unrestricted permissions not permitted", name), nil
+			}
+			d.Permissions = permission.Set(maps.Clone(profile.Permissions))
+			notes = append(notes, "permissions limited to profile maximum")
+		} else {
+			effective := permission.Set{}
+			for _, perm := range slices.Sorted(maps.Keys(req.Permissions)) {
+				level := req.Permissions[perm]
+				limit, ok := profile.Permissions[perm]
+				switch {
+				case !ok:
+					if mode != ModeDownscope {
+						return deny("profile %q: permission %s not permitted", name, perm), nil
+					}
+					notes = append(notes, "dropped permission "+perm)
+				case level.Rank() > limit.Rank():
+					if mode != ModeDownscope {
+						return deny("profile %q: permission %s=%s exceeds %s", name, perm, level, limit), nil
+					}
+					effective[perm] = limit
+					notes = append(notes, fmt.Sprintf("lowered permission %s=%s to %s", perm, level, limit))
+				default:
+					effective[perm] = level
+				}
+			}
+			if len(effective) == 0 {
+				return deny("profile %q: no requested permission is permitted", name), nil
+			}
+			d.Permissions = effective
+		}
+	}
+
+	if len(notes) > 0 {
+		d.Downscoped = true
+		d.Reason = fmt.Sprintf("profile %q: %s", name, strings.Join(notes, "; "))
+	} else {
+		d.Reason = fmt.Sprintf("profile %q: allowed", name)
+	}
+
+	return d, nil
+}
+
+// profile selects the profile applicable to req, returning its name: the
+// explicitly requested profile, regardless of its callers, which Evaluate
+// checks; or else the one profile whose callers match, a caller matching
+// several being an error; or else the default profile.
+func (c *Config) profile(req Request) (string, *Profile, error) {
+	if req.Profile != "" {
+		return req.Profile, c.Profiles[req.Profile], nil
+	}
+
+	if req.Caller != "" {
+		var matched []string
+		for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+			if matchAny(c.Profiles[name].Callers, req.Caller) {
+				matched = append(matched, name)
+			}
+		}
+		switch len(matched) {
+		case 0:
+		case 1:
+			return matched[0], c.Profiles[matched[0]], nil
+		default:
+			return "", nil, fmt.Errorf("caller %q matches multiple profiles %s: select one explicitly", req.Caller, strings.Join(matched, ","))
+		}
+	}
+
+	if c.DefaultProfile != "" {
+		return c.DefaultProfile, c.Profiles[c.DefaultProfile], nil
+	}
+
+	return "", nil, nil
+}
+
+func deny(format string, args ...any) Decision {
+	return Decision{Reason: fmt.Sprintf(format, args...)}
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
@@ -0,0 +1,207 @@
+package policy_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/permission"
+	"github.com/isometry/ghait/policy"
+)
+
+const testPolicy = `
+mode: enforce
+defaultProfile: read-only
+profiles:
+  read-only:
+    permissions:
+      contents: read
+      metadata: read
+  deploy:
+    callers: ["deploy-*"]
+    installations: [42]
+    repositories: ["service-*"]
+    permissions:
+      contents: write
+      deployments: write
+    advisoryLifetime: 15m
+    mode: downscope
+`
+
+func TestParse_Invalid(t *testing.T) {
+	for name, doc := range map[string]string{
+		"unknown field":      "profiles: {a: {repos: [x]}}",
+		"unknown permission": "profiles: {a: {permissions: {content: read}}}",
+		"invalid level":      "profiles: {a: {permissions: {contents: reed}}}",
+		"invalid mode":       "mode: lenient",
+		"missing default":    "defaultProfile: nope",
+		"invalid pattern":    "profiles: {a: {repositories: ['[']}}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := policy.Parse([]byte(doc))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := policy.Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		req      policy.Request
+		allowed  bool
+		expected policy.Decision
+	}{
+		{
+			name: "default profile within limits",
+			req: policy.Request{
+				Caller:      "someone",
+				Permissions: permission.Set{"contents": permission.Read},
+			},
+			allowed: true,
+			expected: policy.Decision{
+				Permissions: permission.Set{"contents": permission.Read},
+			},
+		},
+		{
+			name: "default profile enforced",
+			req: policy.Request{
+				Permissions: permission.Set{"contents": permission.Write},
+			},
+		},
+		{
+			name: "default profile rejects unrestricted permissions",
+			req:  policy.Request{},
+		},
+		{
+			name: "unknown explicit profile",
+			req:  policy.Request{Profile: "nope"},
+		},
+		{
+			name: "caller profile downscoped",
+			req: policy.Request{
+				Caller:         "deploy-bot",
+				InstallationID: 42,
+				Repositories:   []string{"service-a", "other"},
+				Permissions: permission.Set{
+					"contents":    permission.Admin,
+					"deployments": permission.Write,
+					"issues":      permission.Write,
+				},
+			},
+			allowed: true,
+			expected: policy.Decision{
+				Downscoped:   true,
+				Repositories: []string{"service-a"},
+				Permissions: permission.Set{
+					"contents":    permission.Write,
+					"deployments": permission.Write,
+				},
+				AdvisoryLifetime: 15 * time.Minute,
+			},
+		},
+		{
+			name: "explicit profile for matching caller",
+			req: policy.Request{
+				Caller:         "deploy-bot",
+				Profile:        "deploy",
+				InstallationID: 42,
+				Repositories:   []string{"service-a"},
+				Permissions:    permission.Set{"contents": permission.Write},
+			},
+			allowed: true,
+			expected: policy.Decision{
+				Repositories:     []string{"service-a"},
+				Permissions:      permission.Set{"contents": permission.Write},
+				AdvisoryLifetime: 15 * time.Minute,
+			},
+		},
+		{
+			name: "explicit privileged profile for other caller",
+			req: policy.Request{
+				Caller:         "someone",
+				Profile:        "deploy",
+				InstallationID: 42,
+				Repositories:   []string{"service-a"},
+				Permissions:    permission.Set{"contents": permission.Write},
+			},
+		},
+		{
+			name: "explicit privileged profile without caller",
+			req: policy.Request{
+				Profile:        "deploy",
+				InstallationID: 42,
+				Repositories:   []string{"service-a"},
+			},
+		},
+		{
+			name: "caller profile installation not permitted",
+			req: policy.Request{
+				Caller:         "deploy-bot",
+				InstallationID: 7,
+				Repositories:   []string{"service-a"},
+			},
+		},
+		{
+			name: "caller profile rejects all repositories",
+			req: policy.Request{
+				Caller:         "deploy-bot",
+				InstallationID: 42,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := p.Evaluate(context.Background(), tt.req)
+			require.NoError(t, err)
+			assert.NotEmpty(t, d.Reason)
+			assert.Equal(t, tt.allowed, d.Allowed, d.Reason)
+			if !tt.allowed {
+				return
+			}
+			assert.Equal(t, tt.expected.Downscoped, d.Downscoped)
+			assert.Equal(t, tt.expected.Repositories, d.Repositories)
+			assert.Equal(t, tt.expected.Permissions, d.Permissions)
+			assert.Equal(t, tt.expected.AdvisoryLifetime, d.AdvisoryLifetime)
+		})
+	}
+}
+
+func TestEvaluate_OverlappingCallers(t *testing.T) {
+	p, err := policy.Parse([]byte(`
+profiles:
+  deploy:
+    callers: ["deploy-*"]
+    permissions:
+      contents: write
+  bots:
+    callers: ["*-bot"]
+    permissions:
+      contents: read
+`))
+	require.NoError(t, err)
+
+	req := policy.Request{Caller: "deploy-bot", Permissions: permission.Set{"contents": permission.Read}}
+	d, err := p.Evaluate(context.Background(), req)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, `caller "deploy-bot" matches multiple profiles bots,deploy: select one explicitly`, d.Reason)
+
+	req.Profile = "bots"
+	d, err = p.Evaluate(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed, d.Reason)
+	assert.Equal(t, "bots", d.Profile)
+
+	req = policy.Request{Caller: "deploy-prod", Permissions: permission.Set{"contents": permission.Write}}
+	d, err = p.Evaluate(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed, d.Reason)
+	assert.Equal(t, "deploy", d.Profile)
+}
@@ -0,0 +1,109 @@
+// Package policy provides guardrails restricting the repositories and
+// permissions of GitHub App installation tokens requested through ghait.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/isometry/ghait/permission"
+)
+
+// Request describes a token request subject to policy evaluation.
+type Request struct {
+	// Caller identifies the requesting party, if known.
+	Caller string
+	// Profile explicitly selects a policy profile, if set.
+	Profile string
+
+	AppID          int64
+	InstallationID int64
+
+	// Repositories and RepositoryIDs restrict the token to specific
+	// repositories; both empty means all repositories of the installation.
+	Repositories  []string
+	RepositoryIDs []int64
+
+	// Permissions restricts the token to specific permissions; empty means
+	// all permissions granted to the installation.
+	Permissions permission.Set
+}
+
+// Decision is the outcome of a policy evaluation.
+type Decision struct {
+	// Allowed reports whether the (possibly downscoped) request may proceed.
+	Allowed bool
+	// Reason explains the decision.
+	Reason string
+	// Downscoped reports whether the request was narrowed to conform to policy.
+	Downscoped bool
+	// Profile names the policy profile applied, if any.
+	Profile string
+
+	// Repositories, RepositoryIDs and Permissions hold the effective token
+	// restrictions, which may be narrower than those requested. They only
+	// ever narrow the request: a nil restriction keeps that requested, and
+	// any wider restriction is intersected with it.
+	Repositories  []string
+	RepositoryIDs []int64
+	Permissions   permission.Set
+
+	// AdvisoryLifetime is the lifetime within which the issued token should
+	// be used, or zero if unlimited. It is not enforced: GitHub does not
+	// support shortening installation token validity, so the token remains
+	// valid until the expiry reported by GitHub. It is recorded in the audit
+	// trail alone.
+	AdvisoryLifetime time.Duration
+}
+
+// Policy evaluates token requests.
+type Policy interface {
+	Evaluate(ctx context.Context, req Request) (Decision, error)
+}
+
+// Func adapts an ordinary function to the Policy interface.
+type Func func(ctx context.Context, req Request) (Decision, error)
+
+// Evaluate calls f(ctx, req).
+func (f Func) Evaluate(ctx context.Context, req Request) (Decision, error) {
+	return f(ctx, req)
+}
+
+// DeniedError is returned when a request is rejected by policy.
+type DeniedError struct {
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("denied by policy: %s", e.Reason)
+}
+
+type contextKey int
+
+const (
+	callerKey contextKey = iota
+	profileKey
+)
+
+// WithCaller returns a copy of ctx carrying the caller identity.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// CallerFromContext returns the caller identity carried by ctx, if any.
+func CallerFromContext(ctx context.Context) string {
+	caller, _ := ctx.Value(callerKey).(string)
+	return caller
+}
+
+// WithProfile returns a copy of ctx explicitly selecting a policy profile.
+func WithProfile(ctx context.Context, profile string) context.Context {
+	return context.WithValue(ctx, profileKey, profile)
+}
+
+// ProfileFromContext returns the policy profile selected by ctx, if any.
+func ProfileFromContext(ctx context.Context) string {
+	profile, _ := ctx.Value(profileKey).(string)
+	return profile
+}
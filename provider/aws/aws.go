@@ -6,57 +6,270 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
 	"slices"
+	"strings"
+	"sync"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/kms"
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/golang-jwt/jwt/v4"
 
 	"github.com/isometry/ghait/provider"
 )
 
 func init() {
-	provider.Register("aws", NewSigner)
+	provider.RegisterWithOptions("aws", NewSignerWithOptions, options...)
+	provider.RegisterScheme("awskms", "aws", nil)
 }
 
-// awsSigner implements provider.Provider & ghinstallation.Signer for AWS KMS.
+// options are the provider options accepted by the AWS signer.
+var options = []provider.OptionSpec{
+	{Name: "region", Description: "AWS region of the KMS key (default from key ARN or AWS configuration)"},
+	{Name: "profile", Description: "Shared configuration profile (default $AWS_PROFILE)"},
+	{Name: "role_arn", Description: "ARN of a role to assume for access to the KMS key"},
+	{Name: "session_name", Description: "Session name of the assumed role (default ghait)"},
+	{Name: "external_id", Description: "External ID required to assume the role"},
+	{Name: "endpoint", Description: "KMS endpoint URL, such as a VPC endpoint or LocalStack"},
+	{Name: "replica_regions", Description: "Comma-separated regions of multi-region key replicas to fail over to (default discovered)"},
+}
+
+// DefaultSessionName is the session name of roles assumed by the signer.
+const DefaultSessionName = "ghait"
+
+// KMSClient is the subset of the AWS KMS client API used by the signer,
+// satisfied by [kms.Client].
+type KMSClient interface {
+	DescribeKey(ctx context.Context, params *kms.DescribeKeyInput, optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// Replica is a KMS client for a region holding a replica of a multi-region
+// key, to fail over to when the primary region is unreachable.
+type Replica struct {
+	Region string
+	Client KMSClient
+}
+
+// awsSigner implements provider.Provider for AWS KMS.
 type awsSigner struct {
-	context context.Context
-	client  *kms.Client
-	key     string
+	client KMSClient
+	key    string
+	region string
+	logger *slog.Logger
+
+	// newClient creates a client for a replica region discovered by Check,
+	// or is nil if replicas are not to be discovered.
+	newClient func(region string) KMSClient
+
+	mu       sync.RWMutex
+	replicas []Replica
+}
+
+// settings are the provider options of the AWS signer beyond those of the
+// shared AWS configuration.
+type settings struct {
+	roleARN        string
+	sessionName    string
+	externalID     string
+	endpoint       string
+	replicaRegions []string
 }
 
-// NewAwsSigner creates a new AWS signer.
-func NewAwsSigner(ctx context.Context, key string, optFns ...func(*config.LoadOptions) error) (provider.Provider, error) {
-	config, err := config.LoadDefaultConfig(ctx, optFns...)
+// NewAwsSigner creates a new AWS signer, logging to logger if non-nil. If
+// key is an ARN, the region of the key is used unless overridden by optFns.
+func NewAwsSigner(ctx context.Context, key string, logger *slog.Logger, optFns ...func(*config.LoadOptions) error) (provider.Provider, error) {
+	return newAwsSigner(ctx, key, logger, settings{}, optFns...)
+}
+
+func newAwsSigner(ctx context.Context, key string, logger *slog.Logger, settings settings, optFns ...func(*config.LoadOptions) error) (provider.Provider, error) {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	logger = logger.With("provider", "aws", "key", key)
+
+	if region := keyRegion(key); region != "" {
+		optFns = append([]func(*config.LoadOptions) error{config.WithRegion(region)}, optFns...)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
 	if err != nil {
+		logger.Error("failed to load AWS configuration", "error", err)
 		return nil, err
 	}
 
-	client := kms.NewFromConfig(config)
+	if settings.roleARN != "" {
+		sessionName := settings.sessionName
+		if sessionName == "" {
+			sessionName = DefaultSessionName
+		}
+		cfg.Credentials = awssdk.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), settings.roleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = sessionName
+			if settings.externalID != "" {
+				o.ExternalID = &settings.externalID
+			}
+		}))
+		logger.Debug("assuming role", "role_arn", settings.roleARN, "session_name", sessionName)
+	}
+
+	client := kms.NewFromConfig(cfg, func(o *kms.Options) {
+		if settings.endpoint != "" {
+			o.BaseEndpoint = &settings.endpoint
+		}
+	})
+	logger.Debug("created AWS KMS client", "region", cfg.Region, "endpoint", settings.endpoint)
+
+	// replicas are reached through their regional endpoints, as a custom
+	// endpoint is specific to the primary region
+	newClient := func(region string) KMSClient {
+		return kms.NewFromConfig(cfg, func(o *kms.Options) { o.Region = region })
+	}
+
+	signer := &awsSigner{
+		client:    client,
+		key:       key,
+		region:    cfg.Region,
+		logger:    logger,
+		newClient: newClient,
+	}
+	for _, region := range settings.replicaRegions {
+		signer.replicas = append(signer.replicas, Replica{Region: region, Client: newClient(region)})
+	}
+	if len(signer.replicas) > 0 {
+		signer.newClient = nil
+	}
+
+	return signer, nil
+}
+
+// NewAwsSignerWithClient creates a new AWS signer using a pre-configured
+// KMS client, logging to logger if non-nil.
+func NewAwsSignerWithClient(client KMSClient, key string, logger *slog.Logger) provider.Provider {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
 
 	return &awsSigner{
-		context: ctx,
-		client:  client,
-		key:     key,
-	}, nil
+		client: client,
+		key:    key,
+		logger: logger.With("provider", "aws", "key", key),
+	}
+}
+
+// NewAwsSignerWithReplicas creates a new AWS signer for a multi-region key
+// using pre-configured KMS clients, logging to logger if non-nil. Signing
+// fails over to each of the replicas in turn when the primary client cannot
+// reach KMS.
+func NewAwsSignerWithReplicas(client KMSClient, key string, replicas []Replica, logger *slog.Logger) provider.Provider {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	return &awsSigner{
+		client:   client,
+		key:      key,
+		logger:   logger.With("provider", "aws", "key", key),
+		replicas: slices.Clone(replicas),
+	}
 }
 
-// NewSigner returns a new AWS signer with default configuration.
+// NewSigner returns a new AWS signer with default configuration, logging to
+// the logger carried by ctx.
 func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
-	return NewAwsSigner(ctx, key)
+	return NewSignerWithOptions(ctx, key, nil)
 }
 
-func (s *awsSigner) Check() error {
-	input := &kms.DescribeKeyInput{
-		KeyId: &s.key,
+// NewSignerWithOptions returns a new AWS signer configured by the provider
+// options opts, logging to the logger carried by ctx.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	var optFns []func(*config.LoadOptions) error
+	if region := opts.String("region"); region != "" {
+		optFns = append(optFns, config.WithRegion(region))
+	}
+	if profile := opts.String("profile"); profile != "" {
+		optFns = append(optFns, config.WithSharedConfigProfile(profile))
 	}
-	key, err := s.client.DescribeKey(s.context, input)
+
+	settings := settings{
+		roleARN:     opts.String("role_arn"),
+		sessionName: opts.String("session_name"),
+		externalID:  opts.String("external_id"),
+		endpoint:    opts.String("endpoint"),
+	}
+	for region := range strings.SplitSeq(opts.String("replica_regions"), ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			settings.replicaRegions = append(settings.replicaRegions, region)
+		}
+	}
+
+	return newAwsSigner(ctx, key, provider.Logger(ctx), settings, optFns...)
+}
+
+// keyRegion returns the region of key if it is a key or alias ARN, or "".
+func keyRegion(key string) string {
+	if !arn.IsARN(key) {
+		return ""
+	}
+	parsed, err := arn.Parse(key)
+	if err != nil {
+		return ""
+	}
+	return parsed.Region
+}
+
+// replicaKey returns the reference to key in region: the ARN of the replica
+// for a key ARN, or else key itself, as multi-region keys share their key ID
+// across regions.
+func replicaKey(key, region string) string {
+	if !arn.IsARN(key) {
+		return key
+	}
+	parsed, err := arn.Parse(key)
+	if err != nil {
+		return key
+	}
+	parsed.Region = region
+	return parsed.String()
+}
+
+// unreachable reports whether err indicates that KMS could not be reached,
+// rather than that it rejected the request: a failure to connect or a
+// server error.
+func unreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var responseErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &responseErr) {
+		return responseErr.HTTPStatusCode() >= 500
+	}
+	return true
+}
+
+func (s *awsSigner) Check(ctx context.Context) error {
+	if err := s.check(ctx); err != nil {
+		s.logger.Warn("key check failed", "error", err)
+		return err
+	}
+	s.logger.Debug("key check passed")
+	return nil
+}
+
+func (s *awsSigner) check(ctx context.Context) error {
+	key, err := s.describe(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to describe privateKey: %w", err)
 	}
 
+	if s.newClient != nil && key.KeyMetadata.MultiRegionConfiguration != nil {
+		s.discoverReplicas(key.KeyMetadata.MultiRegionConfiguration)
+	}
+
 	if key.KeyMetadata.KeyState != types.KeyStateEnabled {
 		return errors.New("privateKey is not enabled")
 	}
@@ -72,19 +285,106 @@ func (s *awsSigner) Check() error {
 	return nil
 }
 
-// Sign signs the JWT claims with the RSA key.
-func (s *awsSigner) Sign(claims jwt.Claims) (string, error) {
+// describe describes the key within ctx, failing over to each configured
+// replica of a multi-region key in turn if KMS is unreachable. Replicas yet
+// to be discovered cannot be failed over to.
+func (s *awsSigner) describe(ctx context.Context) (*kms.DescribeKeyOutput, error) {
+	key, err := s.client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: &s.key})
+	if err == nil || !unreachable(ctx, err) {
+		return key, err
+	}
+
+	s.mu.RLock()
+	replicas := s.replicas
+	s.mu.RUnlock()
+
+	errs := []error{err}
+	for _, replica := range replicas {
+		s.logger.Warn("KMS unreachable, failing over to replica", "region", replica.Region, "error", err)
+		key, err = replica.Client.DescribeKey(ctx, &kms.DescribeKeyInput{KeyId: awssdk.String(replicaKey(s.key, replica.Region))})
+		if err == nil {
+			return key, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// discoverReplicas configures failover to the regions of the other keys of
+// a multi-region key.
+func (s *awsSigner) discoverReplicas(config *types.MultiRegionConfiguration) {
+	keys := append([]types.MultiRegionKey{}, config.ReplicaKeys...)
+	if config.PrimaryKey != nil {
+		keys = append(keys, *config.PrimaryKey)
+	}
+
+	var replicas []Replica
+	for _, key := range keys {
+		region := awssdk.ToString(key.Region)
+		if region == "" || region == s.region {
+			continue
+		}
+		replicas = append(replicas, Replica{Region: region, Client: s.newClient(region)})
+	}
+
+	s.mu.Lock()
+	s.replicas = replicas
+	s.mu.Unlock()
+
+	if len(replicas) > 0 {
+		s.logger.Debug("discovered multi-region key replicas", "regions", len(replicas))
+	}
+}
+
+// SignContext signs the JWT claims with the RSA key within ctx, failing over
+// to each replica of a multi-region key in turn if KMS is unreachable.
+func (s *awsSigner) SignContext(ctx context.Context, claims jwt.Claims) (string, error) {
+	signed, err := s.sign(ctx, s.client, s.key, claims)
+	if err == nil || !unreachable(ctx, err) {
+		if err != nil {
+			s.logger.Error("KMS sign failed", "error", err)
+		}
+		return signed, err
+	}
+
+	s.mu.RLock()
+	replicas := s.replicas
+	s.mu.RUnlock()
+
+	errs := []error{err}
+	for _, replica := range replicas {
+		s.logger.Warn("KMS unreachable, failing over to replica", "region", replica.Region, "error", err)
+		signed, err = s.sign(ctx, replica.Client, replicaKey(s.key, replica.Region), claims)
+		if err == nil {
+			return signed, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	err = errors.Join(errs...)
+	s.logger.Error("KMS sign failed", "error", err)
+	return "", err
+}
+
+func (s *awsSigner) sign(ctx context.Context, client KMSClient, key string, claims jwt.Claims) (string, error) {
 	method := &awsSigningMethod{
-		context: s.context,
-		client:  s.client,
+		context: ctx,
+		client:  client,
 	}
-	return jwt.NewWithClaims(method, claims).SignedString(s.key)
+	return jwt.NewWithClaims(method, claims).SignedString(key)
 }
 
-// awsSigningMethod implements jwt.SigningMethod for AWS KMS.
+// awsSigningMethod implements jwt.SigningMethod for AWS KMS, signing within
+// the context of a single SignContext call.
 type awsSigningMethod struct {
 	context context.Context
-	client  *kms.Client
+	client  KMSClient
 }
 
 func (s *awsSigningMethod) Alg() string {
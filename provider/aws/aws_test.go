@@ -0,0 +1,313 @@
+package aws_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/aws"
+	"github.com/isometry/ghait/provider/aws/awstest"
+)
+
+func TestAwsSigner(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := awstest.NewServer()
+	defer server.Close()
+	server.AddKey("1234abcd-12ab-34cd-56ef-1234567890ab", private, "alias/github")
+
+	for _, key := range []string{
+		"1234abcd-12ab-34cd-56ef-1234567890ab",
+		"alias/github",
+		server.KeyARN("1234abcd-12ab-34cd-56ef-1234567890ab"),
+	} {
+		t.Run(key, func(t *testing.T) {
+			signer, err := aws.NewAwsSigner(context.Background(), key, nil, server.LoadOptions()...)
+			require.NoError(t, err)
+			require.NoError(t, signer.Check(context.Background()))
+
+			claims := &jwt.RegisteredClaims{
+				Issuer:    "12345",
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			}
+			signed, err := signer.SignContext(context.Background(), claims)
+			require.NoError(t, err)
+
+			parsed, err := jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, func(*jwt.Token) (any, error) {
+				return &private.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+			assert.Equal(t, "12345", parsed.Claims.(*jwt.RegisteredClaims).Issuer)
+		})
+	}
+}
+
+func TestAwsSigner_Check(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := awstest.NewServer()
+	defer server.Close()
+	server.AddKey("disabled", private)
+	server.SetKeyState("disabled", "Disabled")
+
+	for _, key := range []string{"disabled", "missing"} {
+		t.Run(key, func(t *testing.T) {
+			signer, err := aws.NewAwsSigner(context.Background(), key, nil, server.LoadOptions()...)
+			require.NoError(t, err)
+			assert.Error(t, signer.Check(context.Background()))
+		})
+	}
+}
+
+func TestNewAwsSignerWithClient(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := awstest.NewServer()
+	defer server.Close()
+	server.AddKey("1234abcd-12ab-34cd-56ef-1234567890ab", private, "alias/github")
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), server.LoadOptions()...)
+	require.NoError(t, err)
+
+	signer := aws.NewAwsSignerWithClient(kms.NewFromConfig(cfg), "alias/github", nil)
+	require.NoError(t, signer.Check(context.Background()))
+
+	signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+		return &private.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	require.NoError(t, err)
+}
+
+func TestAwsSigner_Context(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := awstest.NewServer()
+	defer server.Close()
+	server.AddKey("github", private)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signer, err := aws.NewAwsSigner(ctx, "github", nil, server.LoadOptions()...)
+	require.NoError(t, err)
+	cancel()
+
+	_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+	require.NoError(t, err, "signer must not retain the construction context")
+
+	_, err = signer.SignContext(ctx, &jwt.RegisteredClaims{Issuer: "12345"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// setEnv isolates the AWS configuration of a test from that of the host,
+// directing clients to server with static credentials.
+func setEnv(t *testing.T, server *awstest.Server) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", awstest.Region)
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+}
+
+func TestAwsSigner_Options(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := awstest.NewServer()
+	defer server.Close()
+	server.Region = "eu-west-1"
+	server.AddKey("github", private, "alias/github")
+
+	setEnv(t, server)
+	require.NoError(t, os.WriteFile(os.Getenv("AWS_CONFIG_FILE"), []byte("[profile ghait]\naws_access_key_id = AKIDTEST\naws_secret_access_key = secret\n"), 0o600))
+
+	tests := map[string]struct {
+		key     string
+		options provider.Options
+		err     string
+	}{
+		"region":              {key: "alias/github", options: provider.Options{"region": "eu-west-1"}},
+		"region from key ARN": {key: server.KeyARN("github"), options: provider.Options{}},
+		"profile":             {key: server.KeyARN("github"), options: provider.Options{"profile": "ghait"}},
+		"endpoint":            {key: server.KeyARN("github"), options: provider.Options{"endpoint": server.URL}},
+		"default region":      {key: "alias/github", options: provider.Options{}, err: "NotFoundException"},
+		"assume role": {
+			key:     server.KeyARN("github"),
+			options: provider.Options{"role_arn": "arn:aws:iam::111122223333:role/ghait", "external_id": "secret"},
+			err:     "AssumeRole",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			signer, err := provider.NewSignerWithOptions(context.Background(), "aws", tt.key, tt.options)
+			require.NoError(t, err)
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return &private.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAwsSigner_Failover(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := awstest.NewServer()
+	defer server.Close()
+	server.AddKey("mrk-1234abcd", private, "alias/github")
+	server.AddReplica("mrk-1234abcd", "eu-west-1")
+
+	setEnv(t, server)
+
+	tests := map[string]struct {
+		key     string
+		options provider.Options
+		check   bool
+	}{
+		"discovered":             {key: "alias/github", options: provider.Options{}, check: true},
+		"discovered for key ARN": {key: server.KeyARN("mrk-1234abcd"), options: provider.Options{}, check: true},
+		"replica_regions":        {key: "mrk-1234abcd", options: provider.Options{"replica_regions": "ap-south-1, eu-west-1"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server.SetUnavailable(awstest.Region, false)
+
+			signer, err := provider.NewSignerWithOptions(context.Background(), "aws", tt.key, tt.options)
+			require.NoError(t, err)
+			if tt.check {
+				require.NoError(t, signer.Check(context.Background()))
+			}
+
+			server.SetUnavailable(awstest.Region, true)
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return &private.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("all unreachable", func(t *testing.T) {
+		server.SetUnavailable(awstest.Region, false)
+
+		signer, err := provider.NewSignerWithOptions(context.Background(), "aws", "alias/github", provider.Options{})
+		require.NoError(t, err)
+		require.NoError(t, signer.Check(context.Background()))
+
+		server.SetUnavailable(awstest.Region, true)
+		server.SetUnavailable("eu-west-1", true)
+		defer server.SetUnavailable("eu-west-1", false)
+
+		_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		assert.ErrorContains(t, err, "KMS is unavailable in us-east-1")
+		assert.ErrorContains(t, err, "KMS is unavailable in eu-west-1")
+	})
+}
+
+func TestAwsSigner_CheckFailover(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := awstest.NewServer()
+	defer server.Close()
+	server.AddKey("mrk-1234abcd", private, "alias/github")
+	server.AddReplica("mrk-1234abcd", "eu-west-1")
+
+	setEnv(t, server)
+
+	// the primary region is down from the start
+	server.SetUnavailable(awstest.Region, true)
+
+	t.Run("replica_regions", func(t *testing.T) {
+		signer, err := provider.NewSignerWithOptions(context.Background(), "aws", "mrk-1234abcd", provider.Options{"replica_regions": "ap-south-1, eu-west-1"})
+		require.NoError(t, err)
+		require.NoError(t, signer.Check(context.Background()))
+
+		_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		require.NoError(t, err)
+	})
+
+	t.Run("key ARN", func(t *testing.T) {
+		signer, err := provider.NewSignerWithOptions(context.Background(), "aws", server.KeyARN("mrk-1234abcd"), provider.Options{"replica_regions": "eu-west-1"})
+		require.NoError(t, err)
+		require.NoError(t, signer.Check(context.Background()))
+	})
+
+	t.Run("replicas undiscovered", func(t *testing.T) {
+		signer, err := provider.NewSignerWithOptions(context.Background(), "aws", "alias/github", provider.Options{})
+		require.NoError(t, err)
+		assert.ErrorContains(t, signer.Check(context.Background()), "KMS is unavailable in us-east-1")
+	})
+}
+
+func TestNewAwsSignerWithReplicas(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := awstest.NewServer()
+	defer server.Close()
+	server.AddKey("mrk-1234abcd", private)
+	server.AddReplica("mrk-1234abcd", "eu-west-1")
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), server.LoadOptions()...)
+	require.NoError(t, err)
+	replica := aws.Replica{
+		Region: "eu-west-1",
+		Client: kms.NewFromConfig(cfg, func(o *kms.Options) { o.Region = "eu-west-1" }),
+	}
+
+	signer := aws.NewAwsSignerWithReplicas(kms.NewFromConfig(cfg), "mrk-1234abcd", []aws.Replica{replica}, nil)
+
+	t.Run("rejected", func(t *testing.T) {
+		server.SetKeyState("mrk-1234abcd", "Disabled")
+		defer server.SetKeyState("mrk-1234abcd", "Enabled")
+
+		_, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		assert.ErrorContains(t, err, "KMSInvalidStateException", "client errors must not fail over")
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		server.SetUnavailable(awstest.Region, true)
+		defer server.SetUnavailable(awstest.Region, false)
+
+		_, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		require.NoError(t, err)
+	})
+}
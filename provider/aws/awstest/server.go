@@ -0,0 +1,331 @@
+// Package awstest provides a fake AWS KMS server for testing the aws
+// provider without AWS credentials or network access.
+package awstest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+const (
+	// Region is the default region of the server.
+	Region = "us-east-1"
+	// Account is the AWS account ID owning the keys of the server.
+	Account = "111122223333"
+)
+
+// Server is a fake AWS KMS server implementing the Sign, DescribeKey and
+// GetPublicKey actions of the KMS JSON API for RSA signing keys. A single
+// server serves every region, distinguishing them by the credential scope
+// of the request signature.
+type Server struct {
+	*httptest.Server
+
+	// Region is the region of keys added with AddKey, and of requests
+	// without a credential scope.
+	Region string
+
+	mu          sync.Mutex
+	keys        map[string]*key
+	aliases     map[string]string
+	unavailable map[string]bool
+}
+
+type key struct {
+	id       string
+	region   string
+	private  *rsa.PrivateKey
+	state    string
+	primary  *key
+	replicas []*key
+}
+
+// NewServer starts and returns a new Server for Region. The caller should
+// call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Region:      Region,
+		keys:        map[string]*key{},
+		aliases:     map[string]string{},
+		unavailable: map[string]bool{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddKey registers an RSA signing key under id, and optionally under
+// aliases of the form "alias/<name>".
+func (s *Server) AddKey(id string, private *rsa.PrivateKey, aliases ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[regionID(s.Region, id)] = &key{id: id, region: s.Region, private: private, state: "Enabled"}
+	for _, alias := range aliases {
+		s.aliases[regionID(s.Region, alias)] = id
+	}
+}
+
+// AddReplica replicates the multi-region key registered under id to region,
+// together with its aliases.
+func (s *Server) AddReplica(id, region string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	primary, ok := s.keys[regionID(s.Region, id)]
+	if !ok {
+		return
+	}
+	replica := &key{id: id, region: region, private: primary.private, state: "Enabled", primary: primary}
+	primary.replicas = append(primary.replicas, replica)
+	s.keys[regionID(region, id)] = replica
+
+	for alias, target := range s.aliases {
+		if name, ok := strings.CutPrefix(alias, s.Region+"|"); ok && target == id {
+			s.aliases[regionID(region, name)] = id
+		}
+	}
+}
+
+// SetKeyState sets the state of the key registered under id in Region, for
+// example to "Disabled" or "PendingDeletion".
+func (s *Server) SetKeyState(id, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if k, ok := s.keys[regionID(s.Region, id)]; ok {
+		k.state = state
+	}
+}
+
+// SetUnavailable makes the server respond to every request for region with
+// a 503 Service Unavailable error, as an unreachable regional endpoint,
+// until called again with unavailable false.
+func (s *Server) SetUnavailable(region string, unavailable bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unavailable[region] = unavailable
+}
+
+// KeyARN returns the ARN of the key registered under id in Region.
+func (s *Server) KeyARN(id string) string {
+	return keyARN(s.Region, id)
+}
+
+func keyARN(region, id string) string {
+	return fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", region, Account, id)
+}
+
+func regionID(region, id string) string {
+	return region + "|" + id
+}
+
+// LoadOptions returns AWS configuration options directing a KMS client to
+// the server with static credentials.
+func (s *Server) LoadOptions() []func(*config.LoadOptions) error {
+	return []func(*config.LoadOptions) error{
+		config.WithRegion(s.Region),
+		config.WithBaseEndpoint(s.URL),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("AKIDTEST", "secret", "")),
+		config.WithRetryMaxAttempts(1),
+	}
+}
+
+// lookup returns the key in region identified by a key ID, key ARN, alias
+// name or alias ARN.
+func (s *Server) lookup(region, keyID string) (*key, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := fmt.Sprintf("arn:aws:kms:%s:%s:", region, Account)
+	keyID = strings.TrimPrefix(strings.TrimPrefix(keyID, prefix), "key/")
+	if id, ok := s.aliases[regionID(region, keyID)]; ok {
+		keyID = id
+	}
+	k, ok := s.keys[regionID(region, keyID)]
+	return k, ok
+}
+
+// requestRegion returns the region of the credential scope of the request
+// signature, or Region if there is none.
+func (s *Server) requestRegion(r *http.Request) string {
+	_, credential, ok := strings.Cut(r.Header.Get("Authorization"), "Credential=")
+	if !ok {
+		return s.Region
+	}
+	// Credential=<access key>/<date>/<region>/<service>/aws4_request
+	scope := strings.Split(strings.SplitN(credential, ",", 2)[0], "/")
+	if len(scope) < 3 || scope[2] == "" {
+		return s.Region
+	}
+	return scope[2]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	region := s.requestRegion(r)
+
+	s.mu.Lock()
+	unavailable := s.unavailable[region]
+	s.mu.Unlock()
+
+	if unavailable {
+		writeError(w, http.StatusServiceUnavailable, "ServiceUnavailableException", fmt.Sprintf("KMS is unavailable in %s", region))
+		return
+	}
+
+	target := r.Header.Get("X-Amz-Target")
+	action, ok := strings.CutPrefix(target, "TrentService.")
+	if r.Method != http.MethodPost || !ok {
+		writeError(w, http.StatusBadRequest, "UnknownOperationException", target)
+		return
+	}
+
+	var input struct {
+		KeyId            string
+		Message          []byte
+		MessageType      string
+		SigningAlgorithm string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "SerializationException", err.Error())
+		return
+	}
+
+	k, ok := s.lookup(region, input.KeyId)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "NotFoundException", fmt.Sprintf("Key '%s' does not exist", input.KeyId))
+		return
+	}
+
+	switch action {
+	case "DescribeKey":
+		s.describeKey(w, k)
+	case "GetPublicKey":
+		s.getPublicKey(w, k)
+	case "Sign":
+		s.sign(w, k, input.Message, input.MessageType, input.SigningAlgorithm)
+	default:
+		writeError(w, http.StatusBadRequest, "UnknownOperationException", action)
+	}
+}
+
+func (s *Server) describeKey(w http.ResponseWriter, k *key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metadata := map[string]any{
+		"AWSAccountId":      Account,
+		"KeyId":             k.id,
+		"Arn":               keyARN(k.region, k.id),
+		"Enabled":           k.state == "Enabled",
+		"KeyState":          k.state,
+		"KeyUsage":          "SIGN_VERIFY",
+		"KeySpec":           keySpec(k.private),
+		"SigningAlgorithms": signingAlgorithms,
+	}
+
+	primary, keyType := k, "PRIMARY"
+	if k.primary != nil {
+		primary, keyType = k.primary, "REPLICA"
+	}
+	if len(primary.replicas) > 0 {
+		replicas := make([]map[string]string, len(primary.replicas))
+		for i, replica := range primary.replicas {
+			replicas[i] = map[string]string{"Arn": keyARN(replica.region, replica.id), "Region": replica.region}
+		}
+		metadata["MultiRegion"] = true
+		metadata["MultiRegionConfiguration"] = map[string]any{
+			"MultiRegionKeyType": keyType,
+			"PrimaryKey":         map[string]string{"Arn": keyARN(primary.region, primary.id), "Region": primary.region},
+			"ReplicaKeys":        replicas,
+		}
+	}
+
+	writeJSON(w, map[string]any{"KeyMetadata": metadata})
+}
+
+func (s *Server) getPublicKey(w http.ResponseWriter, k *key) {
+	der, err := x509.MarshalPKIXPublicKey(&k.private.PublicKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KMSInternalException", err.Error())
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"KeyId":             keyARN(k.region, k.id),
+		"PublicKey":         der,
+		"KeySpec":           keySpec(k.private),
+		"KeyUsage":          "SIGN_VERIFY",
+		"SigningAlgorithms": signingAlgorithms,
+	})
+}
+
+func (s *Server) sign(w http.ResponseWriter, k *key, message []byte, messageType, algorithm string) {
+	s.mu.Lock()
+	state := k.state
+	s.mu.Unlock()
+
+	if state != "Enabled" {
+		writeError(w, http.StatusBadRequest, "KMSInvalidStateException", fmt.Sprintf("%s is %s", keyARN(k.region, k.id), state))
+		return
+	}
+	if algorithm != "RSASSA_PKCS1_V1_5_SHA_256" {
+		writeError(w, http.StatusBadRequest, "InvalidKeyUsageException", fmt.Sprintf("unsupported signing algorithm %s", algorithm))
+		return
+	}
+
+	digest := message
+	if messageType != "DIGEST" {
+		sum := sha256.Sum256(message)
+		digest = sum[:]
+	}
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, digest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ValidationException", err.Error())
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"KeyId":            keyARN(k.region, k.id),
+		"Signature":        signature,
+		"SigningAlgorithm": algorithm,
+	})
+}
+
+var signingAlgorithms = []string{
+	"RSASSA_PKCS1_V1_5_SHA_256",
+	"RSASSA_PKCS1_V1_5_SHA_384",
+	"RSASSA_PKCS1_V1_5_SHA_512",
+	"RSASSA_PSS_SHA_256",
+	"RSASSA_PSS_SHA_384",
+	"RSASSA_PSS_SHA_512",
+}
+
+func keySpec(private *rsa.PrivateKey) string {
+	return fmt.Sprintf("RSA_%d", private.N.BitLen())
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-ErrorType", errorType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"__type": errorType, "message": message})
+}
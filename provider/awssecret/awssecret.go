@@ -0,0 +1,105 @@
+// Package awssecret provides a signer for an RSA private key held in AWS
+// Secrets Manager.
+package awssecret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/keysource"
+)
+
+func init() {
+	provider.RegisterWithOptions("aws-secret", NewSignerWithOptions, options...)
+}
+
+// options are the provider options accepted by the AWS Secrets Manager signer.
+var options = []provider.OptionSpec{
+	{Name: "region", Description: "AWS region of the secret (default from secret ARN or AWS configuration)"},
+	{Name: "profile", Description: "Shared configuration profile (default $AWS_PROFILE)"},
+	{Name: "endpoint", Description: "Secrets Manager endpoint URL, such as a VPC endpoint or LocalStack"},
+	{Name: "version_stage", Description: "Staging label of the secret version (default AWSCURRENT)"},
+	keysource.JSONKeyOption,
+	keysource.RefreshOption,
+}
+
+// Client is the subset of the AWS Secrets Manager client API used by the
+// signer, satisfied by [secretsmanager.Client].
+type Client interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// NewSigner returns a new AWS Secrets Manager signer with default
+// configuration, logging to the logger carried by ctx.
+func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
+	return NewSignerWithOptions(ctx, key, nil)
+}
+
+// NewSignerWithOptions returns a new signer for the RSA key held in the
+// secret named by key, its name or ARN, configured by the provider options
+// opts, logging to the logger carried by ctx.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	logger := provider.Logger(ctx).With("provider", "aws-secret", "key", key)
+
+	var optFns []func(*config.LoadOptions) error
+	if parsed, err := arn.Parse(key); err == nil {
+		optFns = append(optFns, config.WithRegion(parsed.Region))
+	}
+	if region := opts.String("region"); region != "" {
+		optFns = append(optFns, config.WithRegion(region))
+	}
+	if profile := opts.String("profile"); profile != "" {
+		optFns = append(optFns, config.WithSharedConfigProfile(profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		logger.Error("failed to load AWS configuration", "error", err)
+		return nil, err
+	}
+
+	client := secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		if endpoint := opts.String("endpoint"); endpoint != "" {
+			o.BaseEndpoint = &endpoint
+		}
+	})
+	logger.Debug("created AWS Secrets Manager client", "region", cfg.Region)
+
+	fetch := Fetcher(client, key, opts.String("version_stage"), opts.String("json_key"))
+	return keysource.New(ctx, fetch, opts.Duration("refresh"), logger)
+}
+
+// Fetcher returns a keysource.Fetcher reading the RSA key from the secret
+// secretID with client: the version labelled versionStage, or AWSCURRENT if
+// empty, and the field jsonKey of a JSON secret, or else the whole secret.
+func Fetcher(client Client, secretID, versionStage, jsonKey string) keysource.Fetcher {
+	return func(ctx context.Context) ([]byte, error) {
+		input := &secretsmanager.GetSecretValueInput{SecretId: &secretID}
+		if versionStage != "" {
+			input.VersionStage = &versionStage
+		}
+
+		output, err := client.GetSecretValue(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret value: %w", err)
+		}
+
+		var data []byte
+		switch {
+		case output.SecretString != nil:
+			data = []byte(*output.SecretString)
+		case output.SecretBinary != nil:
+			data = output.SecretBinary
+		default:
+			return nil, errors.New("secret has no value")
+		}
+
+		return keysource.JSONField(data, jsonKey)
+	}
+}
@@ -0,0 +1,108 @@
+package awssecret_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider"
+	_ "github.com/isometry/ghait/provider/awssecret"
+)
+
+// newSecretsServer returns a fake Secrets Manager server holding secrets by
+// name and version stage.
+func newSecretsServer(t *testing.T, secrets map[string]map[string]string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			SecretId     string
+			VersionStage string
+		}
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || json.NewDecoder(r.Body).Decode(&input) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if input.VersionStage == "" {
+			input.VersionStage = "AWSCURRENT"
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		value, ok := secrets[input.SecretId][input.VersionStage]
+		if !ok {
+			w.Header().Set("X-Amzn-ErrorType", "ResourceNotFoundException")
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"__type": "ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Name": input.SecretId, "SecretString": value})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAwsSecretSigner(t *testing.T) {
+	current, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+	previous, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	secretJSON, err := json.Marshal(map[string]string{"private_key": string(current.PrivateKeyPEM())})
+	require.NoError(t, err)
+
+	server := newSecretsServer(t, map[string]map[string]string{
+		"github/app": {
+			"AWSCURRENT":  string(current.PrivateKeyPEM()),
+			"AWSPREVIOUS": string(previous.PrivateKeyPEM()),
+		},
+		"github/app.json": {"AWSCURRENT": string(secretJSON)},
+	})
+
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	tests := map[string]struct {
+		key      string
+		options  provider.Options
+		expected *ghaittest.Provider
+		err      string
+	}{
+		"current":       {key: "github/app", options: provider.Options{}, expected: current},
+		"version stage": {key: "github/app", options: provider.Options{"version_stage": "AWSPREVIOUS"}, expected: previous},
+		"json key":      {key: "github/app.json", options: provider.Options{"json_key": "private_key"}, expected: current},
+		"missing":       {key: "github/missing", options: provider.Options{}, err: "ResourceNotFoundException"},
+		"not a key":     {key: "github/app.json", options: provider.Options{}, err: "failed to decode RSA private key"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.options["endpoint"] = server.URL
+			signer, err := provider.NewSignerWithOptions(context.Background(), "aws-secret", tt.key, tt.options)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return tt.expected.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Package env provides a signer for an RSA private key held in an
+// environment variable.
+package env
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/keysource"
+)
+
+func init() {
+	provider.RegisterWithOptions("env", NewSignerWithOptions, options...)
+}
+
+// options are the provider options accepted by the environment signer.
+var options = []provider.OptionSpec{
+	{Name: "unset", Type: provider.Bool, Description: "Unset the variable once read, hiding it from child processes"},
+}
+
+// nameRegexp matches a portable environment variable name.
+var nameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// NewSigner returns a new environment signer with default configuration,
+// logging to the logger carried by ctx.
+func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
+	return NewSignerWithOptions(ctx, key, nil)
+}
+
+// NewSignerWithOptions returns a new signer for the PEM encoded RSA key held
+// in the environment variable named by key, such as "GHAIT_PRIVATE_KEY",
+// configured by the provider options opts, logging to the logger carried
+// by ctx. The key is read once, keeping it out of the process arguments.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	logger := provider.Logger(ctx).With("provider", "env", "key", key)
+
+	if !nameRegexp.MatchString(key) {
+		return nil, fmt.Errorf("invalid environment variable name %q", key)
+	}
+
+	signer, err := keysource.New(ctx, Fetcher(key), 0, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Bool("unset") {
+		if err := os.Unsetenv(key); err != nil {
+			return nil, fmt.Errorf("failed to unset %s: %w", key, err)
+		}
+	}
+	return signer, nil
+}
+
+// Fetcher returns a keysource.Fetcher reading the RSA key from the
+// environment variable name.
+func Fetcher(name string) keysource.Fetcher {
+	return func(context.Context) ([]byte, error) {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return []byte(value), nil
+	}
+}
@@ -0,0 +1,58 @@
+package env_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider"
+	_ "github.com/isometry/ghait/provider/env"
+)
+
+func TestEnvSigner(t *testing.T) {
+	key, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		key     string
+		value   string
+		options provider.Options
+		err     string
+	}{
+		"variable":     {key: "GHAIT_TEST_KEY", value: string(key.PrivateKeyPEM()), options: provider.Options{}},
+		"uri":          {key: "env://GHAIT_TEST_KEY", value: string(key.PrivateKeyPEM()), options: provider.Options{}},
+		"unset":        {key: "GHAIT_TEST_KEY", value: string(key.PrivateKeyPEM()), options: provider.Options{"unset": "true"}},
+		"not set":      {key: "GHAIT_TEST_MISSING", options: provider.Options{}, err: "environment variable GHAIT_TEST_MISSING is not set"},
+		"invalid name": {key: "GHAIT TEST KEY", options: provider.Options{}, err: "invalid environment variable name"},
+		"invalid key":  {key: "GHAIT_TEST_KEY", value: "not a key", options: provider.Options{}, err: "failed to decode RSA private key"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("GHAIT_TEST_KEY", tt.value)
+
+			signer, err := provider.NewSignerWithOptions(context.Background(), "env", tt.key, tt.options)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, set := os.LookupEnv("GHAIT_TEST_KEY")
+			assert.Equal(t, !tt.options.Bool("unset"), set)
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return key.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Package exec provides a signer for an RSA private key printed by a
+// command, such as a password manager.
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	osexec "os/exec"
+	"strings"
+	"time"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/keysource"
+)
+
+func init() {
+	provider.RegisterWithOptions("exec", NewSignerWithOptions, options...)
+}
+
+// DefaultTimeout is the default time allowed for the command to complete.
+const DefaultTimeout = 30 * time.Second
+
+// options are the provider options accepted by the command signer.
+var options = []provider.OptionSpec{
+	{Name: "timeout", Type: provider.Duration, Description: "Time allowed for the command to complete (default 30s)"},
+	keysource.RefreshOption,
+}
+
+// NewSigner returns a new command signer with default configuration,
+// logging to the logger carried by ctx.
+func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
+	return NewSignerWithOptions(ctx, key, nil)
+}
+
+// NewSignerWithOptions returns a new signer for the PEM encoded RSA key
+// printed to stdout by the command line key, such as "pass show github-app",
+// configured by the provider options opts, logging to the logger carried
+// by ctx. The command line is split into words as by a POSIX shell, without
+// expansions; the command is run directly, not by a shell.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	logger := provider.Logger(ctx).With("provider", "exec", "key", key)
+
+	args, err := split(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid command %q: %w", key, err)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	timeout := opts.Duration("timeout")
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return keysource.New(ctx, Fetcher(args[0], args[1:], timeout), opts.Duration("refresh"), logger)
+}
+
+// Fetcher returns a keysource.Fetcher reading the RSA key from the stdout
+// of the command name run with args, killed should it not complete within
+// timeout.
+func Fetcher(name string, args []string, timeout time.Duration) keysource.Fetcher {
+	return func(ctx context.Context) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		var stdout, stderr bytes.Buffer
+		cmd := osexec.CommandContext(ctx, name, args...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		// don't wait on descendants holding stdout open once killed
+		cmd.WaitDelay = time.Second
+
+		if err := cmd.Run(); err != nil {
+			clear(stdout.Bytes())
+			if ctx.Err() != nil {
+				err = fmt.Errorf("%w: %w", err, ctx.Err())
+			}
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("command %s: %w: %s", name, err, msg)
+			}
+			return nil, fmt.Errorf("command %s: %w", name, err)
+		}
+		if stdout.Len() == 0 {
+			return nil, fmt.Errorf("command %s: empty output", name)
+		}
+		return stdout.Bytes(), nil
+	}
+}
+
+// split splits the command line s into words, honouring single quotes,
+// double quotes and backslash escapes much as a POSIX shell does.
+func split(s string) ([]string, error) {
+	var (
+		words []string
+		word  strings.Builder
+		inArg bool
+		quote rune
+		esc   bool
+	)
+
+	for _, r := range s {
+		switch {
+		case esc:
+			word.WriteRune(r)
+			esc = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && (quote == 0 || quote == '"'):
+			esc = true
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				words = append(words, word.String())
+				word.Reset()
+				inArg = false
+			}
+		default:
+			word.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if esc || quote != 0 {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
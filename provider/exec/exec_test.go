@@ -0,0 +1,67 @@
+package exec_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider"
+	_ "github.com/isometry/ghait/provider/exec"
+)
+
+func TestExecSigner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test commands require a POSIX shell")
+	}
+
+	key, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "github app.pem")
+	require.NoError(t, os.WriteFile(keyFile, key.PrivateKeyPEM(), 0o600))
+
+	tests := map[string]struct {
+		key     string
+		options provider.Options
+		err     string
+	}{
+		"single quotes": {key: "cat '" + keyFile + "'", options: provider.Options{}},
+		"double quotes": {key: `cat "` + keyFile + `"`, options: provider.Options{}},
+		"escaped":       {key: `sh -c 'cat "$0"' ` + filepath.Dir(keyFile) + `/github\ app.pem`, options: provider.Options{}},
+		"uri":           {key: "exec://cat%20'" + keyFile + "'?timeout=5s", options: provider.Options{}},
+		"failure":       {key: `sh -c 'echo "no such secret" >&2; exit 1'`, options: provider.Options{}, err: "exit status 1: no such secret"},
+		"timeout":       {key: "sleep 5", options: provider.Options{"timeout": "100ms"}, err: "context deadline exceeded"},
+		"empty output":  {key: "true", options: provider.Options{}, err: "command true: empty output"},
+		"not found":     {key: "ghait-no-such-command", options: provider.Options{}, err: "executable file not found"},
+		"invalid key":   {key: "echo not a key", options: provider.Options{}, err: "failed to decode RSA private key"},
+		"unterminated":  {key: "cat 'key.pem", options: provider.Options{}, err: "unterminated quote"},
+		"empty command": {key: "  ", options: provider.Options{}, err: "empty command"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			signer, err := provider.NewSignerWithOptions(context.Background(), "exec", tt.key, tt.options)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return key.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+}
@@ -4,26 +4,22 @@ package file
 import (
 	"context"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"errors"
-	"fmt"
 	"os"
 	"path/filepath"
 
 	"github.com/golang-jwt/jwt/v4"
 
 	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/keysource"
 )
 
 func init() {
 	provider.Register("file", NewSigner)
 }
 
-// fileSigner implements provider.Provider & ghinstallation.Signer with a local RSA key file.
+// fileSigner implements provider.Provider with a local RSA key file.
 type fileSigner struct {
-	context context.Context
-	key     *rsa.PrivateKey
+	key *rsa.PrivateKey
 }
 
 // NewSigner creates a new file signer.
@@ -39,32 +35,24 @@ func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
 		keyBytes = []byte(key)
 	}
 
-	if keyBytes == nil {
-		return nil, errors.New("empty key")
-	}
-
-	block, _ := pem.Decode(keyBytes)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		return nil, errors.New("failed to decode RSA private key")
-	}
+	defer clear(keyBytes)
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	privateKey, err := keysource.ParsePrivateKey(keyBytes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+		return nil, err
 	}
 
 	return &fileSigner{
-		context: ctx,
-		key:     privateKey,
+		key: privateKey,
 	}, nil
 }
 
-func (s *fileSigner) Check() error {
+func (s *fileSigner) Check(context.Context) error {
 	// validated within NewSigner
 	return nil
 }
 
-// Sign signs the JWT claims with the RSA key.
-func (s *fileSigner) Sign(claims jwt.Claims) (string, error) {
+// SignContext signs the JWT claims with the RSA key.
+func (s *fileSigner) SignContext(_ context.Context, claims jwt.Claims) (string, error) {
 	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(s.key)
 }
@@ -6,10 +6,22 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
 
 	"cloud.google.com/go/kms/apiv1/kmspb"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	kms "cloud.google.com/go/kms/apiv1"
 
@@ -17,53 +29,280 @@ import (
 )
 
 func init() {
-	provider.Register("gcp", NewSigner)
+	provider.RegisterWithOptions("gcp", NewSignerWithOptions, options...)
+	provider.RegisterScheme("gcpkms", "gcp", nil)
 }
 
-// gcpSigner implements provider.Provider & ghinstallation.Signer for GCP KMS.
+// options are the provider options accepted by the GCP signer.
+var options = []provider.OptionSpec{
+	{Name: "credentials_file", Description: "Service account or external account credentials file (default application default credentials)"},
+	{Name: "impersonate_service_account", Description: "Email of a service account to impersonate for access to the KMS key"},
+	{Name: "endpoint", Description: "KMS endpoint, such as a Private Service Connect endpoint"},
+}
+
+// KMSClient is the subset of the GCP KMS client API used by the signer, to
+// which NewKMSClient adapts [kms.KeyManagementClient].
+type KMSClient interface {
+	GetCryptoKey(ctx context.Context, req *kmspb.GetCryptoKeyRequest, opts ...gax.CallOption) (*kmspb.CryptoKey, error)
+	ListCryptoKeyVersions(ctx context.Context, req *kmspb.ListCryptoKeyVersionsRequest, opts ...gax.CallOption) CryptoKeyVersionIterator
+	GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error)
+	AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error)
+}
+
+// CryptoKeyVersionIterator iterates over crypto key versions, returning
+// iterator.Done once exhausted; satisfied by [kms.CryptoKeyVersionIterator].
+type CryptoKeyVersionIterator interface {
+	Next() (*kmspb.CryptoKeyVersion, error)
+}
+
+// NewKMSClient returns client as a KMSClient.
+func NewKMSClient(client *kms.KeyManagementClient) KMSClient {
+	return kmsClient{client}
+}
+
+type kmsClient struct {
+	*kms.KeyManagementClient
+}
+
+func (c kmsClient) ListCryptoKeyVersions(ctx context.Context, req *kmspb.ListCryptoKeyVersionsRequest, opts ...gax.CallOption) CryptoKeyVersionIterator {
+	return c.KeyManagementClient.ListCryptoKeyVersions(ctx, req, opts...)
+}
+
+// gcpSigner implements provider.Provider for GCP KMS.
 type gcpSigner struct {
-	context context.Context
-	client  *kms.KeyManagementClient
-	key     string
+	client KMSClient
+	// closer closes client, if owned by the signer.
+	closer io.Closer
+	key    string
+	logger *slog.Logger
+
+	mu sync.Mutex
+	// version caches the crypto key version resolved from a crypto key name.
+	version string
 }
 
-// NewGcpSigner creates a new GCP signer.
-func NewGcpSigner(ctx context.Context, key string, opts ...option.ClientOption) (provider.Provider, error) {
+// NewGcpSigner creates a new GCP signer, logging to logger if non-nil.
+func NewGcpSigner(ctx context.Context, key string, logger *slog.Logger, opts ...option.ClientOption) (provider.Provider, error) {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	logger = logger.With("provider", "gcp", "key", key)
+
 	client, err := kms.NewKeyManagementClient(ctx, opts...)
 	if err != nil {
+		logger.Error("failed to create GCP KMS client", "error", err)
 		return nil, err
 	}
+	logger.Debug("created GCP KMS client")
 
 	return &gcpSigner{
-		context: ctx,
-		client:  client,
-		key:     key,
+		client: NewKMSClient(client),
+		closer: client,
+		key:    key,
+		logger: logger,
 	}, nil
 }
 
-// NewSigner returns a new GCP signer with default configuration.
+// NewGcpSignerWithClient creates a new GCP signer using a pre-configured
+// KMS client, which the signer leaves open, logging to logger if non-nil.
+func NewGcpSignerWithClient(client KMSClient, key string, logger *slog.Logger) provider.Provider {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	return &gcpSigner{
+		client: client,
+		key:    key,
+		logger: logger.With("provider", "gcp", "key", key),
+	}
+}
+
+// NewSigner returns a new GCP signer with default configuration, logging to
+// the logger carried by ctx.
 func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
-	return NewGcpSigner(ctx, key)
+	return NewSignerWithOptions(ctx, key, nil)
 }
 
-func (s *gcpSigner) Check() error {
-	// TODO: implement appropriate checks
+// NewSignerWithOptions returns a new GCP signer configured by the provider
+// options opts, logging to the logger carried by ctx.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	var clientOpts []option.ClientOption
+	if file := opts.String("credentials_file"); file != "" {
+		clientOpts = append(clientOpts, option.WithCredentialsFile(file))
+	}
+
+	if target := opts.String("impersonate_service_account"); target != "" {
+		// the token source refreshes within the context it is created with,
+		// which must outlive the constructor
+		tokenSource, err := impersonate.CredentialsTokenSource(context.WithoutCancel(ctx), impersonate.CredentialsConfig{
+			TargetPrincipal: target,
+			Scopes:          kms.DefaultAuthScopes(),
+		}, clientOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("impersonate %s: %w", target, err)
+		}
+		clientOpts = []option.ClientOption{option.WithTokenSource(tokenSource)}
+	}
+
+	if endpoint := opts.String("endpoint"); endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(endpoint))
+	}
+
+	return NewGcpSigner(ctx, key, provider.Logger(ctx), clientOpts...)
+}
+
+// Close closes the KMS client created by NewGcpSigner.
+func (s *gcpSigner) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+func (s *gcpSigner) Check(ctx context.Context) error {
+	if err := s.check(ctx); err != nil {
+		s.logger.Warn("key check failed", "error", err)
+		return err
+	}
+	s.logger.Debug("key check passed")
+	return nil
+}
+
+func (s *gcpSigner) check(ctx context.Context) error {
+	name, err := s.resolve(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	key, err := s.client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: name})
+	if err != nil {
+		return fmt.Errorf("failed to get public key: %w", err)
+	}
+	if key.GetPemCrc32C() != nil && key.GetPemCrc32C().GetValue() != checksum([]byte(key.GetPem())) {
+		return errors.New("public key checksum mismatch")
+	}
+
+	if !compatible(key.GetAlgorithm()) {
+		return fmt.Errorf("key algorithm %s is not RS256 compatible", key.GetAlgorithm())
+	}
 	return nil
 }
 
-// Sign signs the JWT claims with the RSA key.
-func (s *gcpSigner) Sign(claims jwt.Claims) (string, error) {
+// compatible reports whether keys of algorithm produce RS256 signatures.
+func compatible(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) bool {
+	switch algorithm {
+	case kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256,
+		kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256:
+		return true
+	default:
+		return false
+	}
+}
+
+// resolve returns the name of the crypto key version to sign with: the key
+// itself if it names a crypto key version, or else the primary version of
+// the crypto key if enabled and RS256 compatible, or else its newest such
+// version. The resolved version is cached unless refresh is set.
+func (s *gcpSigner) resolve(ctx context.Context, refresh bool) (string, error) {
+	if strings.Contains(s.key, "/cryptoKeyVersions/") {
+		return s.key, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.version != "" && !refresh {
+		return s.version, nil
+	}
+
+	version, err := s.resolveVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	if version != s.version {
+		s.logger.Debug("resolved crypto key version", "version", version)
+	}
+	s.version = version
+	return version, nil
+}
+
+func (s *gcpSigner) resolveVersion(ctx context.Context) (string, error) {
+	key, err := s.client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: s.key})
+	if err != nil {
+		return "", fmt.Errorf("failed to get crypto key: %w", err)
+	}
+
+	if primary := key.GetPrimary(); primary.GetState() == kmspb.CryptoKeyVersion_ENABLED && compatible(primary.GetAlgorithm()) {
+		return primary.GetName(), nil
+	}
+
+	var newest string
+	var newestID int
+	it := s.client.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{
+		Parent: s.key,
+		Filter: "state=ENABLED",
+	})
+	for {
+		version, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to list crypto key versions: %w", err)
+		}
+		if version.GetState() != kmspb.CryptoKeyVersion_ENABLED || !compatible(version.GetAlgorithm()) {
+			continue
+		}
+		_, id, _ := strings.Cut(version.GetName(), "/cryptoKeyVersions/")
+		if n, err := strconv.Atoi(id); err == nil && n > newestID {
+			newest, newestID = version.GetName(), n
+		}
+	}
+
+	if newest == "" {
+		return "", fmt.Errorf("crypto key %s has no enabled RS256 compatible version", s.key)
+	}
+	return newest, nil
+}
+
+// SignContext signs the JWT claims with the RSA key within ctx. If the
+// crypto key version resolved from a crypto key name can no longer be used,
+// such as after key rotation, the version is resolved afresh and signing
+// retried once.
+func (s *gcpSigner) SignContext(ctx context.Context, claims jwt.Claims) (string, error) {
+	signed, err := s.sign(ctx, claims, false)
+	if err != nil && !strings.Contains(s.key, "/cryptoKeyVersions/") {
+		if code := status.Code(err); code == codes.FailedPrecondition || code == codes.NotFound {
+			s.logger.Info("crypto key version unusable, resolving afresh", "error", err)
+			signed, err = s.sign(ctx, claims, true)
+		}
+	}
+	if err != nil {
+		s.logger.Error("KMS sign failed", "error", err)
+		return "", err
+	}
+	return signed, nil
+}
+
+func (s *gcpSigner) sign(ctx context.Context, claims jwt.Claims, refresh bool) (string, error) {
+	name, err := s.resolve(ctx, refresh)
+	if err != nil {
+		return "", err
+	}
+
 	method := &gcpSigningMethod{
-		context: s.context,
+		context: ctx,
 		client:  s.client,
 	}
-	return jwt.NewWithClaims(method, claims).SignedString(s.key)
+	return jwt.NewWithClaims(method, claims).SignedString(name)
 }
 
-// gcpSigningMethod implements jwt.SigningMethod for GCP KMS.
+// gcpSigningMethod implements jwt.SigningMethod for GCP KMS, signing within
+// the context of a single SignContext call.
 type gcpSigningMethod struct {
 	context context.Context
-	client  *kms.KeyManagementClient
+	client  KMSClient
 }
 
 func (s *gcpSigningMethod) Alg() string {
@@ -77,17 +316,35 @@ func (s *gcpSigningMethod) Sign(data string, ikey any) (string, error) {
 	}
 
 	req := &kmspb.AsymmetricSignRequest{
-		Name: key,
-		Data: []byte(data),
+		Name:       key,
+		Data:       []byte(data),
+		DataCrc32C: wrapperspb.Int64(checksum([]byte(data))),
 	}
 	resp, err := s.client.AsymmetricSign(s.context, req)
 	if err != nil {
 		return "", err
 	}
 
+	// guard against corruption in transit, as recommended by Cloud KMS
+	switch {
+	case !resp.GetVerifiedDataCrc32C():
+		return "", errors.New("data checksum not verified by KMS")
+	case resp.GetName() != key:
+		return "", fmt.Errorf("signed with unexpected key %s", resp.GetName())
+	case resp.GetSignatureCrc32C().GetValue() != checksum(resp.GetSignature()):
+		return "", errors.New("signature checksum mismatch")
+	}
+
 	return base64.RawURLEncoding.EncodeToString(resp.GetSignature()), nil
 }
 
 func (s *gcpSigningMethod) Verify(string, string, any) error {
 	return errors.New("not implemented")
 }
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum returns the CRC32C checksum of data.
+func checksum(data []byte) int64 {
+	return int64(crc32.Checksum(data, castagnoli))
+}
@@ -0,0 +1,342 @@
+package gcp_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/gcp"
+	"github.com/isometry/ghait/provider/gcp/gcptest"
+)
+
+const cryptoKey = "projects/example/locations/global/keyRings/ghait/cryptoKeys/github"
+
+func TestGcpSigner(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := gcptest.NewServer()
+	defer server.Close()
+	key := server.AddKey(cryptoKey, private)
+
+	opts, err := server.ClientOptions()
+	require.NoError(t, err)
+
+	signer, err := gcp.NewGcpSigner(context.Background(), key, nil, opts...)
+	require.NoError(t, err)
+	require.NoError(t, signer.Check(context.Background()))
+
+	claims := &jwt.RegisteredClaims{
+		Issuer:    "12345",
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+	signed, err := signer.SignContext(context.Background(), claims)
+	require.NoError(t, err)
+
+	parsed, err := jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, func(*jwt.Token) (any, error) {
+		return &private.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	require.NoError(t, err)
+	assert.Equal(t, "12345", parsed.Claims.(*jwt.RegisteredClaims).Issuer)
+}
+
+func TestGcpSigner_UnknownKey(t *testing.T) {
+	server := gcptest.NewServer()
+	defer server.Close()
+
+	opts, err := server.ClientOptions()
+	require.NoError(t, err)
+
+	signer, err := gcp.NewGcpSigner(context.Background(), cryptoKey+"/cryptoKeyVersions/1", nil, opts...)
+	require.NoError(t, err)
+
+	_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+	assert.ErrorContains(t, err, "NotFound")
+}
+
+// stubClient is a gcp.KMSClient reporting an algorithm incompatible with RS256.
+type stubClient struct {
+	gcp.KMSClient
+}
+
+func (stubClient) GetPublicKey(context.Context, *kmspb.GetPublicKeyRequest, ...gax.CallOption) (*kmspb.PublicKey, error) {
+	return &kmspb.PublicKey{Algorithm: kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256}, nil
+}
+
+func TestNewGcpSignerWithClient(t *testing.T) {
+	signer := gcp.NewGcpSignerWithClient(stubClient{}, cryptoKey+"/cryptoKeyVersions/1", nil)
+	assert.ErrorContains(t, signer.Check(context.Background()), "not RS256 compatible")
+}
+
+func TestGcpSigner_ResolveVersion(t *testing.T) {
+	keys := make([]*rsa.PrivateKey, 3)
+	for i := range keys {
+		var err error
+		keys[i], err = rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+	}
+
+	tests := map[string]struct {
+		setup    func(*gcptest.Server) []string
+		expected int
+	}{
+		"newest enabled": {
+			setup: func(s *gcptest.Server) []string {
+				return []string{s.AddKey(cryptoKey, keys[0]), s.AddKey(cryptoKey, keys[1]), s.AddKey(cryptoKey, keys[2])}
+			},
+			expected: 2,
+		},
+		"newest disabled": {
+			setup: func(s *gcptest.Server) []string {
+				versions := []string{s.AddKey(cryptoKey, keys[0]), s.AddKey(cryptoKey, keys[1]), s.AddKey(cryptoKey, keys[2])}
+				s.SetVersionState(versions[2], kmspb.CryptoKeyVersion_DISABLED)
+				return versions
+			},
+			expected: 1,
+		},
+		"primary": {
+			setup: func(s *gcptest.Server) []string {
+				versions := []string{s.AddKey(cryptoKey, keys[0]), s.AddKey(cryptoKey, keys[1]), s.AddKey(cryptoKey, keys[2])}
+				s.SetPrimary(versions[0])
+				return versions
+			},
+			expected: 0,
+		},
+		"primary disabled": {
+			setup: func(s *gcptest.Server) []string {
+				versions := []string{s.AddKey(cryptoKey, keys[0]), s.AddKey(cryptoKey, keys[1]), s.AddKey(cryptoKey, keys[2])}
+				s.SetPrimary(versions[0])
+				s.SetVersionState(versions[0], kmspb.CryptoKeyVersion_DISABLED)
+				return versions
+			},
+			expected: 2,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := gcptest.NewServer()
+			defer server.Close()
+			tt.setup(server)
+
+			opts, err := server.ClientOptions()
+			require.NoError(t, err)
+
+			signer, err := gcp.NewGcpSigner(context.Background(), cryptoKey, nil, opts...)
+			require.NoError(t, err)
+			require.NoError(t, signer.Check(context.Background()))
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return &keys[tt.expected].PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("none enabled", func(t *testing.T) {
+		server := gcptest.NewServer()
+		defer server.Close()
+		server.SetVersionState(server.AddKey(cryptoKey, keys[0]), kmspb.CryptoKeyVersion_DISABLED)
+
+		opts, err := server.ClientOptions()
+		require.NoError(t, err)
+
+		signer, err := gcp.NewGcpSigner(context.Background(), cryptoKey, nil, opts...)
+		require.NoError(t, err)
+		assert.ErrorContains(t, signer.Check(context.Background()), "no enabled RS256 compatible version")
+	})
+
+	t.Run("rotated", func(t *testing.T) {
+		server := gcptest.NewServer()
+		defer server.Close()
+		v1 := server.AddKey(cryptoKey, keys[0])
+
+		opts, err := server.ClientOptions()
+		require.NoError(t, err)
+
+		signer, err := gcp.NewGcpSigner(context.Background(), cryptoKey, nil, opts...)
+		require.NoError(t, err)
+		require.NoError(t, signer.Check(context.Background()))
+
+		server.AddKey(cryptoKey, keys[1])
+		server.SetVersionState(v1, kmspb.CryptoKeyVersion_DISABLED)
+
+		signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		require.NoError(t, err)
+
+		_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+			return &keys[1].PublicKey, nil
+		}, jwt.WithValidMethods([]string{"RS256"}))
+		require.NoError(t, err)
+	})
+}
+
+// corruptingClient is a gcp.KMSClient corrupting the responses of the
+// wrapped client to AsymmetricSign.
+type corruptingClient struct {
+	gcp.KMSClient
+	corrupt func(*kmspb.AsymmetricSignResponse)
+}
+
+func (c corruptingClient) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error) {
+	resp, err := c.KMSClient.AsymmetricSign(ctx, req, opts...)
+	if err == nil {
+		c.corrupt(resp)
+	}
+	return resp, err
+}
+
+func TestGcpSigner_Checksums(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := gcptest.NewServer()
+	defer server.Close()
+	key := server.AddKey(cryptoKey, private)
+
+	opts, err := server.ClientOptions()
+	require.NoError(t, err)
+	client, err := kms.NewKeyManagementClient(context.Background(), opts...)
+	require.NoError(t, err)
+	defer client.Close()
+
+	tests := map[string]struct {
+		corrupt  func(*kmspb.AsymmetricSignResponse)
+		expected string
+	}{
+		"signature": {
+			corrupt:  func(resp *kmspb.AsymmetricSignResponse) { resp.Signature[0] ^= 0xff },
+			expected: "signature checksum mismatch",
+		},
+		"unverified data": {
+			corrupt:  func(resp *kmspb.AsymmetricSignResponse) { resp.VerifiedDataCrc32C = false },
+			expected: "data checksum not verified",
+		},
+		"name": {
+			corrupt:  func(resp *kmspb.AsymmetricSignResponse) { resp.Name = cryptoKey + "/cryptoKeyVersions/2" },
+			expected: "signed with unexpected key",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			signer := gcp.NewGcpSignerWithClient(corruptingClient{KMSClient: gcp.NewKMSClient(client), corrupt: tt.corrupt}, key, nil)
+
+			_, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestGcpSigner_Options(t *testing.T) {
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	_, err := provider.NewSignerWithOptions(context.Background(), "gcp", cryptoKey, provider.Options{
+		"credentials_file": filepath.Join(t.TempDir(), "missing.json"),
+	})
+	assert.ErrorContains(t, err, "missing.json")
+
+	_, err = provider.NewSignerWithOptions(context.Background(), "gcp", cryptoKey, provider.Options{
+		"project": "example",
+	})
+	assert.ErrorContains(t, err, `unknown option "project"`)
+}
+
+func TestGcpSigner_Close(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := gcptest.NewServer()
+	defer server.Close()
+	key := server.AddKey(cryptoKey, private)
+
+	opts, err := server.ClientOptions()
+	require.NoError(t, err)
+
+	// the signer closes the client it creates
+	signer, err := gcp.NewGcpSigner(context.Background(), key, nil, opts...)
+	require.NoError(t, err)
+	require.NoError(t, signer.(io.Closer).Close())
+	assert.Error(t, signer.Check(context.Background()))
+
+	// but leaves a client it is given open
+	opts, err = server.ClientOptions()
+	require.NoError(t, err)
+	client, err := kms.NewKeyManagementClient(context.Background(), opts...)
+	require.NoError(t, err)
+	defer client.Close()
+
+	signer = gcp.NewGcpSignerWithClient(gcp.NewKMSClient(client), key, nil)
+	require.NoError(t, signer.(io.Closer).Close())
+	assert.NoError(t, signer.Check(context.Background()))
+}
+
+// versionsClient is a gcp.KMSClient holding a crypto key with versions, of
+// which none is primary, recording the public keys requested.
+type versionsClient struct {
+	gcp.KMSClient
+	versions  []*kmspb.CryptoKeyVersion
+	requested []string
+}
+
+func (c *versionsClient) GetCryptoKey(_ context.Context, req *kmspb.GetCryptoKeyRequest, _ ...gax.CallOption) (*kmspb.CryptoKey, error) {
+	return &kmspb.CryptoKey{Name: req.GetName()}, nil
+}
+
+func (c *versionsClient) ListCryptoKeyVersions(context.Context, *kmspb.ListCryptoKeyVersionsRequest, ...gax.CallOption) gcp.CryptoKeyVersionIterator {
+	return &versionIterator{versions: c.versions}
+}
+
+func (c *versionsClient) GetPublicKey(_ context.Context, req *kmspb.GetPublicKeyRequest, _ ...gax.CallOption) (*kmspb.PublicKey, error) {
+	c.requested = append(c.requested, req.GetName())
+	return &kmspb.PublicKey{Name: req.GetName(), Algorithm: kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256}, nil
+}
+
+type versionIterator struct {
+	versions []*kmspb.CryptoKeyVersion
+}
+
+func (it *versionIterator) Next() (*kmspb.CryptoKeyVersion, error) {
+	if len(it.versions) == 0 {
+		return nil, iterator.Done
+	}
+	version := it.versions[0]
+	it.versions = it.versions[1:]
+	return version, nil
+}
+
+func TestNewGcpSignerWithClient_ResolveVersion(t *testing.T) {
+	version := func(id string, algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) *kmspb.CryptoKeyVersion {
+		return &kmspb.CryptoKeyVersion{
+			Name:      cryptoKey + "/cryptoKeyVersions/" + id,
+			State:     kmspb.CryptoKeyVersion_ENABLED,
+			Algorithm: algorithm,
+		}
+	}
+
+	client := &versionsClient{versions: []*kmspb.CryptoKeyVersion{
+		version("2", kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256),
+		version("10", kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256),
+		version("11", kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256),
+	}}
+	signer := gcp.NewGcpSignerWithClient(client, cryptoKey, nil)
+	require.NoError(t, signer.Check(context.Background()))
+	assert.Equal(t, []string{cryptoKey + "/cryptoKeyVersions/10"}, client.requested)
+}
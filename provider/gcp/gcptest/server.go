@@ -0,0 +1,297 @@
+// Package gcptest provides an in-process fake GCP Cloud KMS gRPC server for
+// testing the gcp provider without GCP credentials or network access.
+package gcptest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Server is a fake GCP Cloud KMS server implementing the key lookup and
+// asymmetric signing RPCs of the KeyManagementService for RSA keys.
+type Server struct {
+	kmspb.UnimplementedKeyManagementServiceServer
+
+	listener *bufconn.Listener
+	server   *grpc.Server
+
+	mu   sync.Mutex
+	keys map[string]*cryptoKey
+}
+
+type cryptoKey struct {
+	versions []*version
+	primary  int
+}
+
+type version struct {
+	private *rsa.PrivateKey
+	state   kmspb.CryptoKeyVersion_CryptoKeyVersionState
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		listener: bufconn.Listen(1 << 20),
+		server:   grpc.NewServer(),
+		keys:     map[string]*cryptoKey{},
+	}
+	kmspb.RegisterKeyManagementServiceServer(s.server, s)
+	go func() { _ = s.server.Serve(s.listener) }()
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Stop()
+}
+
+// ClientOptions returns client options connecting a KMS client to the server.
+func (s *Server) ClientOptions() ([]option.ClientOption, error) {
+	conn, err := grpc.NewClient("passthrough:///gcptest",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []option.ClientOption{option.WithGRPCConn(conn)}, nil
+}
+
+// AddKey registers an RSA key as a new enabled version of the crypto key
+// name, of the form "projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>",
+// returning the name of the crypto key version.
+func (s *Server) AddKey(name string, private *rsa.PrivateKey) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[name]
+	if !ok {
+		k = &cryptoKey{}
+		s.keys[name] = k
+	}
+	k.versions = append(k.versions, &version{
+		private: private,
+		state:   kmspb.CryptoKeyVersion_ENABLED,
+	})
+	return versionName(name, len(k.versions))
+}
+
+// SetVersionState sets the state of the named crypto key version, for
+// example to kmspb.CryptoKeyVersion_DISABLED.
+func (s *Server) SetVersionState(name string, state kmspb.CryptoKeyVersion_CryptoKeyVersionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, err := s.lookupVersion(name); err == nil {
+		v.state = state
+	}
+}
+
+// SetPrimary sets the named crypto key version as the primary version of
+// its crypto key.
+func (s *Server) SetPrimary(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, n, _ := strings.Cut(name, "/cryptoKeyVersions/")
+	if k, ok := s.keys[key]; ok {
+		for i := range k.versions {
+			if fmt.Sprint(i+1) == n {
+				k.primary = i + 1
+			}
+		}
+	}
+}
+
+func versionName(key string, n int) string {
+	return fmt.Sprintf("%s/cryptoKeyVersions/%d", key, n)
+}
+
+// lookupVersion returns the crypto key version of the given name; s.mu must be held.
+func (s *Server) lookupVersion(name string) (*version, error) {
+	key, n, ok := strings.Cut(name, "/cryptoKeyVersions/")
+	if k, found := s.keys[key]; ok && found {
+		for i, v := range k.versions {
+			if fmt.Sprint(i+1) == n {
+				return v, nil
+			}
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "%s not found", name)
+}
+
+// GetCryptoKey implements kmspb.KeyManagementServiceServer.
+func (s *Server) GetCryptoKey(_ context.Context, req *kmspb.GetCryptoKeyRequest) (*kmspb.CryptoKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[req.GetName()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%s not found", req.GetName())
+	}
+
+	key := &kmspb.CryptoKey{
+		Name:    req.GetName(),
+		Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
+		VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+			Algorithm: algorithm(k.versions[len(k.versions)-1].private),
+		},
+	}
+	if k.primary > 0 {
+		key.Primary = cryptoKeyVersion(versionName(req.GetName(), k.primary), k.versions[k.primary-1])
+	}
+	return key, nil
+}
+
+// ListCryptoKeyVersions implements kmspb.KeyManagementServiceServer.
+func (s *Server) ListCryptoKeyVersions(_ context.Context, req *kmspb.ListCryptoKeyVersionsRequest) (*kmspb.ListCryptoKeyVersionsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[req.GetParent()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%s not found", req.GetParent())
+	}
+
+	resp := &kmspb.ListCryptoKeyVersionsResponse{TotalSize: int32(len(k.versions))}
+	for i, v := range k.versions {
+		resp.CryptoKeyVersions = append(resp.CryptoKeyVersions, cryptoKeyVersion(versionName(req.GetParent(), i+1), v))
+	}
+	return resp, nil
+}
+
+// GetCryptoKeyVersion implements kmspb.KeyManagementServiceServer.
+func (s *Server) GetCryptoKeyVersion(_ context.Context, req *kmspb.GetCryptoKeyVersionRequest) (*kmspb.CryptoKeyVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, err := s.lookupVersion(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return cryptoKeyVersion(req.GetName(), v), nil
+}
+
+// GetPublicKey implements kmspb.KeyManagementServiceServer.
+func (s *Server) GetPublicKey(_ context.Context, req *kmspb.GetPublicKeyRequest) (*kmspb.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, err := s.lookupVersion(req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&v.private.PublicKey)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	return &kmspb.PublicKey{
+		Name:      req.GetName(),
+		Pem:       publicPEM,
+		PemCrc32C: wrapperspb.Int64(checksum([]byte(publicPEM))),
+		Algorithm: algorithm(v.private),
+	}, nil
+}
+
+// AsymmetricSign implements kmspb.KeyManagementServiceServer.
+func (s *Server) AsymmetricSign(_ context.Context, req *kmspb.AsymmetricSignRequest) (*kmspb.AsymmetricSignResponse, error) {
+	s.mu.Lock()
+	v, err := s.lookupVersion(req.GetName())
+	var state kmspb.CryptoKeyVersion_CryptoKeyVersionState
+	if err == nil {
+		state = v.state
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	if state != kmspb.CryptoKeyVersion_ENABLED {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s is not enabled, current state is: %s", req.GetName(), state)
+	}
+
+	resp := &kmspb.AsymmetricSignResponse{Name: req.GetName()}
+
+	var digest []byte
+	switch {
+	case req.GetData() != nil:
+		if req.GetDataCrc32C() != nil {
+			if req.GetDataCrc32C().GetValue() != checksum(req.GetData()) {
+				return nil, status.Error(codes.InvalidArgument, "data_crc32c does not match data")
+			}
+			resp.VerifiedDataCrc32C = true
+		}
+		sum := sha256.Sum256(req.GetData())
+		digest = sum[:]
+	case req.GetDigest().GetSha256() != nil:
+		if req.GetDigestCrc32C() != nil {
+			if req.GetDigestCrc32C().GetValue() != checksum(req.GetDigest().GetSha256()) {
+				return nil, status.Error(codes.InvalidArgument, "digest_crc32c does not match digest")
+			}
+			resp.VerifiedDigestCrc32C = true
+		}
+		digest = req.GetDigest().GetSha256()
+	default:
+		return nil, status.Error(codes.InvalidArgument, "data or SHA-256 digest is required")
+	}
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, v.private, crypto.SHA256, digest)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	resp.Signature = signature
+	resp.SignatureCrc32C = wrapperspb.Int64(checksum(signature))
+	return resp, nil
+}
+
+func cryptoKeyVersion(name string, v *version) *kmspb.CryptoKeyVersion {
+	return &kmspb.CryptoKeyVersion{
+		Name:      name,
+		State:     v.state,
+		Algorithm: algorithm(v.private),
+	}
+}
+
+func algorithm(private *rsa.PrivateKey) kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm {
+	switch private.N.BitLen() {
+	case 2048:
+		return kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256
+	case 3072:
+		return kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256
+	case 4096:
+		return kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256
+	default:
+		return kmspb.CryptoKeyVersion_CRYPTO_KEY_VERSION_ALGORITHM_UNSPECIFIED
+	}
+}
+
+func checksum(data []byte) int64 {
+	return int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+}
@@ -0,0 +1,119 @@
+// Package gcpsecret provides a signer for an RSA private key held in GCP
+// Secret Manager.
+package gcpsecret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/keysource"
+)
+
+func init() {
+	provider.RegisterWithOptions("gcp-secret", NewSignerWithOptions, options...)
+}
+
+// options are the provider options accepted by the GCP Secret Manager signer.
+var options = []provider.OptionSpec{
+	{Name: "credentials_file", Description: "Service account or external account credentials file (default application default credentials)"},
+	{Name: "endpoint", Description: "Secret Manager endpoint, such as a regional or Private Service Connect endpoint"},
+	keysource.JSONKeyOption,
+	keysource.RefreshOption,
+}
+
+// Client is the subset of the GCP Secret Manager client API used by the
+// signer, satisfied by [secretmanager.Client].
+type Client interface {
+	AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest, opts ...gax.CallOption) (*secretmanagerpb.AccessSecretVersionResponse, error)
+}
+
+// NewSigner returns a new GCP Secret Manager signer with default
+// configuration, logging to the logger carried by ctx.
+func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
+	return NewSignerWithOptions(ctx, key, nil)
+}
+
+// NewSignerWithOptions returns a new signer for the RSA key held in the
+// secret version named by key, configured by the provider options opts,
+// logging to the logger carried by ctx.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	logger := provider.Logger(ctx).With("provider", "gcp-secret", "key", key)
+
+	var clientOpts []option.ClientOption
+	if file := opts.String("credentials_file"); file != "" {
+		clientOpts = append(clientOpts, option.WithCredentialsFile(file))
+	}
+	if endpoint := opts.String("endpoint"); endpoint != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(endpoint))
+	}
+
+	client, err := secretmanager.NewClient(ctx, clientOpts...)
+	if err != nil {
+		logger.Error("failed to create GCP Secret Manager client", "error", err)
+		return nil, err
+	}
+	logger.Debug("created GCP Secret Manager client")
+
+	refresh := opts.Duration("refresh")
+	signer, err := keysource.New(ctx, Fetcher(client, key, opts.String("json_key")), refresh, logger)
+	if err != nil || refresh <= 0 {
+		// the client is needed only to refresh the key
+		_ = client.Close()
+		return signer, err
+	}
+
+	return &secretSigner{Provider: signer, client: client}, nil
+}
+
+// secretSigner is a signer refreshing its key with a client it owns.
+type secretSigner struct {
+	provider.Provider
+	client *secretmanager.Client
+}
+
+// Close closes the Secret Manager client.
+func (s *secretSigner) Close() error {
+	return s.client.Close()
+}
+
+// Fetcher returns a keysource.Fetcher reading the RSA key from the secret
+// version name with client, verifying its checksum: name is of the form
+// "projects/<p>/secrets/<s>/versions/<v>", or "projects/<p>/secrets/<s>"
+// for the latest version. The key is taken from the field jsonKey of a JSON
+// secret, or else the whole secret.
+func Fetcher(client Client, name, jsonKey string) keysource.Fetcher {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	return func(ctx context.Context) ([]byte, error) {
+		resp, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+		if err != nil {
+			return nil, fmt.Errorf("failed to access secret version: %w", err)
+		}
+
+		payload := resp.GetPayload()
+		if payload.GetDataCrc32C() != 0 && payload.GetDataCrc32C() != checksum(payload.GetData()) {
+			return nil, errors.New("secret checksum mismatch")
+		}
+
+		return keysource.JSONField(payload.GetData(), jsonKey)
+	}
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum returns the CRC32C checksum of data.
+func checksum(data []byte) int64 {
+	return int64(crc32.Checksum(data, castagnoli))
+}
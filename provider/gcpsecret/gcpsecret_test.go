@@ -0,0 +1,128 @@
+package gcpsecret_test
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"net"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider/gcpsecret"
+	"github.com/isometry/ghait/provider/keysource"
+)
+
+// secretServer is a fake Secret Manager server holding secret versions by name.
+type secretServer struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+
+	versions map[string][]byte
+	corrupt  bool
+}
+
+func (s *secretServer) AccessSecretVersion(_ context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	data, ok := s.versions[req.GetName()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Secret Version [%s] not found.", req.GetName())
+	}
+
+	crc := int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+	if s.corrupt {
+		crc++
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    req.GetName(),
+		Payload: &secretmanagerpb.SecretPayload{Data: data, DataCrc32C: &crc},
+	}, nil
+}
+
+func newClient(t *testing.T, server *secretServer) *secretmanager.Client {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(listener) }()
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///gcpsecret",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	client, err := secretmanager.NewClient(context.Background(), option.WithGRPCConn(conn))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestGcpSecretSigner(t *testing.T) {
+	latest, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+	first, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	secretJSON, err := json.Marshal(map[string]string{"private_key": string(latest.PrivateKeyPEM())})
+	require.NoError(t, err)
+
+	const secret = "projects/example/secrets/github-app"
+	server := &secretServer{versions: map[string][]byte{
+		secret + "/versions/latest":      latest.PrivateKeyPEM(),
+		secret + "/versions/1":           first.PrivateKeyPEM(),
+		secret + "-json/versions/latest": secretJSON,
+	}}
+	client := newClient(t, server)
+
+	tests := map[string]struct {
+		key      string
+		jsonKey  string
+		expected *ghaittest.Provider
+	}{
+		"latest":   {key: secret, expected: latest},
+		"version":  {key: secret + "/versions/1", expected: first},
+		"json key": {key: secret + "-json", jsonKey: "private_key", expected: latest},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			signer, err := keysource.New(context.Background(), gcpsecret.Fetcher(client, tt.key, tt.jsonKey), 0, nil)
+			require.NoError(t, err)
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return tt.expected.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := keysource.New(context.Background(), gcpsecret.Fetcher(client, secret+"/versions/2", ""), 0, nil)
+		assert.ErrorContains(t, err, "NotFound")
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		server.corrupt = true
+		defer func() { server.corrupt = false }()
+
+		_, err := keysource.New(context.Background(), gcpsecret.Fetcher(client, secret, ""), 0, nil)
+		assert.ErrorContains(t, err, "secret checksum mismatch")
+	})
+}
@@ -0,0 +1,154 @@
+// Package keysource provides signers for RSA private keys fetched from a
+// secret store, rather than held by a signing KMS.
+package keysource
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/isometry/ghait/provider"
+)
+
+// RefreshOption is the provider option setting the interval at which a key
+// source is fetched afresh.
+var RefreshOption = provider.OptionSpec{
+	Name:        "refresh",
+	Type:        provider.Duration,
+	Description: "Interval at which to fetch the key afresh (default never)",
+}
+
+// JSONKeyOption is the provider option selecting the field of a JSON secret
+// holding the key.
+var JSONKeyOption = provider.OptionSpec{
+	Name:        "json_key",
+	Description: "Field of a JSON object secret holding the key (default whole secret)",
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS #1 RSA private key, as issued
+// for GitHub Apps.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty key")
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, errors.New("failed to decode RSA private key")
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+	}
+	return privateKey, nil
+}
+
+// JSONField returns the string value of the named field of the JSON object
+// data, or data itself if name is empty.
+func JSONField(data []byte, name string) ([]byte, error) {
+	if name == "" {
+		return data, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	value, ok := fields[name].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret has no string field %q", name)
+	}
+	return []byte(value), nil
+}
+
+// Fetcher fetches a PEM encoded RSA private key from a secret store.
+type Fetcher func(ctx context.Context) ([]byte, error)
+
+// signer implements provider.Provider with an RSA key fetched from a secret
+// store and cached in memory.
+type signer struct {
+	fetch   Fetcher
+	refresh time.Duration
+	logger  *slog.Logger
+
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	fetched time.Time
+}
+
+// New returns a signer with the RSA key fetched within ctx, logging to
+// logger if non-nil. If refresh is positive, the key is fetched afresh once
+// it is older than refresh, within the context of the next signing request;
+// should that fail, the cached key remains in use.
+func New(ctx context.Context, fetch Fetcher, refresh time.Duration, logger *slog.Logger) (provider.Provider, error) {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	s := &signer{
+		fetch:   fetch,
+		refresh: refresh,
+		logger:  logger,
+	}
+
+	key, err := s.load(ctx)
+	if err != nil {
+		logger.Error("failed to fetch key", "error", err)
+		return nil, err
+	}
+	s.key, s.fetched = key, time.Now()
+	logger.Debug("fetched key", "refresh", refresh)
+
+	return s, nil
+}
+
+// load fetches and parses the key, clearing the fetched key material.
+func (s *signer) load(ctx context.Context) (*rsa.PrivateKey, error) {
+	data, err := s.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(data)
+
+	return ParsePrivateKey(data)
+}
+
+func (s *signer) Check(context.Context) error {
+	// validated within New
+	return nil
+}
+
+// SignContext signs the JWT claims with the RSA key, first fetching it
+// afresh within ctx if due.
+func (s *signer) SignContext(ctx context.Context, claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(s.current(ctx))
+}
+
+// current returns the cached key, fetching it afresh if due.
+func (s *signer) current(ctx context.Context) *rsa.PrivateKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refresh <= 0 || time.Since(s.fetched) < s.refresh {
+		return s.key
+	}
+
+	key, err := s.load(ctx)
+	if err != nil {
+		s.logger.Warn("failed to refresh key, using cached key", "age", time.Since(s.fetched), "error", err)
+		return s.key
+	}
+	s.key, s.fetched = key, time.Now()
+	s.logger.Debug("refreshed key")
+	return s.key
+}
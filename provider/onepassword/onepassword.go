@@ -0,0 +1,85 @@
+// Package onepassword provides a signer for an RSA private key held in
+// 1Password, read with the 1Password CLI.
+package onepassword
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/keysource"
+)
+
+func init() {
+	provider.RegisterWithOptions("op", NewSignerWithOptions, options...)
+	// the key is the secret reference, scheme included
+	provider.RegisterScheme("op", "op", func(ref string) string { return "op://" + ref })
+}
+
+// DefaultCLI is the name of the 1Password CLI executable.
+const DefaultCLI = "op"
+
+// options are the provider options accepted by the 1Password signer.
+var options = []provider.OptionSpec{
+	{Name: "account", Description: "1Password account to read from (default $OP_ACCOUNT or the only signed-in account)"},
+	{Name: "cli", Description: "Path of the 1Password CLI (default op from $PATH)"},
+	keysource.RefreshOption,
+}
+
+// NewSigner returns a new 1Password signer with default configuration,
+// logging to the logger carried by ctx.
+func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
+	return NewSignerWithOptions(ctx, key, nil)
+}
+
+// NewSignerWithOptions returns a new signer for the RSA key held in the
+// field named by key, a secret reference of the form
+// "op://<vault>/<item>/<field>", configured by the provider options opts,
+// logging to the logger carried by ctx.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	logger := provider.Logger(ctx).With("provider", "op", "key", key)
+
+	if !strings.HasPrefix(key, "op://") {
+		return nil, fmt.Errorf("invalid secret reference %q: expected op://<vault>/<item>/<field>", key)
+	}
+
+	cli := opts.String("cli")
+	if cli == "" {
+		cli = DefaultCLI
+	}
+
+	return keysource.New(ctx, Fetcher(cli, key, opts.String("account")), opts.Duration("refresh"), logger)
+}
+
+// Fetcher returns a keysource.Fetcher reading the RSA key from the secret
+// reference ref with the 1Password CLI cli, from account if non-empty. The
+// CLI authenticates as usual, such as with $OP_SERVICE_ACCOUNT_TOKEN.
+func Fetcher(cli, ref, account string) keysource.Fetcher {
+	return func(ctx context.Context) ([]byte, error) {
+		args := []string{"read", "--no-newline"}
+		if account != "" {
+			args = append(args, "--account", account)
+		}
+		args = append(args, ref)
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, cli, args...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+		if err := cmd.Run(); err != nil {
+			clear(stdout.Bytes())
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("1Password CLI: %w: %s", err, msg)
+			}
+			return nil, fmt.Errorf("1Password CLI: %w", err)
+		}
+		if stdout.Len() == 0 {
+			return nil, errors.New("1Password CLI: empty secret")
+		}
+		return stdout.Bytes(), nil
+	}
+}
@@ -0,0 +1,83 @@
+package onepassword_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider"
+	_ "github.com/isometry/ghait/provider/onepassword"
+)
+
+// fakeCLI writes a fake 1Password CLI to dir, printing the key file for
+// op://github/app/private_key in the account "example", returning its path.
+func fakeCLI(t *testing.T, dir, keyFile string) string {
+	t.Helper()
+
+	script := `#!/bin/sh
+[ "$1" = read ] && [ "$2" = --no-newline ] || { echo "[ERROR] unexpected arguments: $*" >&2; exit 1; }
+shift 2
+if [ "$1" = --account ]; then
+	[ "$2" = example ] || { echo "[ERROR] account $2 not found" >&2; exit 1; }
+	shift 2
+fi
+[ "$1" = op://github/app/private_key ] || { echo "[ERROR] could not read secret '$1'" >&2; exit 1; }
+cat "` + keyFile + `"
+`
+	cli := filepath.Join(dir, "op")
+	require.NoError(t, os.WriteFile(cli, []byte(script), 0o700))
+	return cli
+}
+
+func TestOnePasswordSigner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI requires a POSIX shell")
+	}
+
+	key, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, key.PrivateKeyPEM(), 0o600))
+	cli := fakeCLI(t, dir, keyFile)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := map[string]struct {
+		key     string
+		options provider.Options
+		err     string
+	}{
+		"path":            {key: "op://github/app/private_key", options: provider.Options{}},
+		"cli":             {key: "op://github/app/private_key", options: provider.Options{"cli": cli, "account": "example"}},
+		"unknown account": {key: "op://github/app/private_key", options: provider.Options{"account": "other"}, err: "account other not found"},
+		"unknown secret":  {key: "op://github/app/password", options: provider.Options{}, err: "could not read secret"},
+		"not a reference": {key: "github/app/private_key", options: provider.Options{}, err: "invalid secret reference"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			signer, err := provider.NewSignerWithOptions(context.Background(), "op", tt.key, tt.options)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return key.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+}
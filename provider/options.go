@@ -0,0 +1,127 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OptionType is the type of a provider option value.
+type OptionType int
+
+const (
+	String OptionType = iota
+	Bool
+	Int
+	Duration
+)
+
+// String returns the name of the option type.
+func (t OptionType) String() string {
+	switch t {
+	case Bool:
+		return "bool"
+	case Int:
+		return "int"
+	case Duration:
+		return "duration"
+	default:
+		return "string"
+	}
+}
+
+// OptionSpec declares an option accepted by a provider.
+type OptionSpec struct {
+	Name        string
+	Type        OptionType
+	Description string
+	// Allowed lists the valid values of a String option; any value is valid
+	// if empty.
+	Allowed []string
+}
+
+// validate returns an error if value is not valid for the option.
+func (o OptionSpec) validate(value string) error {
+	var err error
+	switch o.Type {
+	case Bool:
+		_, err = strconv.ParseBool(value)
+	case Int:
+		_, err = strconv.Atoi(value)
+	case Duration:
+		_, err = time.ParseDuration(value)
+	default:
+		if len(o.Allowed) > 0 && !slices.Contains(o.Allowed, value) {
+			return fmt.Errorf("invalid value %q for option %q (allowed: %s)", value, o.Name, strings.Join(o.Allowed, ", "))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s value %q for option %q", o.Type, value, o.Name)
+	}
+	return nil
+}
+
+// Options holds provider options by name. Values are validated against the
+// OptionSpecs of the provider before it is constructed, so the typed
+// accessors return the zero value only for unset options.
+type Options map[string]string
+
+// String returns the value of the named option, or "" if unset.
+func (o Options) String(name string) string {
+	return o[name]
+}
+
+// Bool returns the value of the named boolean option, or false if unset.
+func (o Options) Bool(name string) bool {
+	v, _ := strconv.ParseBool(o[name])
+	return v
+}
+
+// Int returns the value of the named integer option, or 0 if unset.
+func (o Options) Int(name string) int {
+	v, _ := strconv.Atoi(o[name])
+	return v
+}
+
+// Duration returns the value of the named duration option, or 0 if unset.
+func (o Options) Duration(name string) time.Duration {
+	v, _ := time.ParseDuration(o[name])
+	return v
+}
+
+// ValidateOptions checks opts against the options declared by the named
+// provider, returning an error for each unknown option or invalid value.
+func ValidateOptions(provider string, opts Options) error {
+	r, ok := lookup(provider)
+	if !ok {
+		return ErrUnsupportedProvider
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(opts)) {
+		i := slices.IndexFunc(r.options, func(o OptionSpec) bool { return o.Name == name })
+		if i < 0 {
+			errs = append(errs, fmt.Errorf("unknown option %q for provider %s%s", name, provider, accepted(r.options)))
+			continue
+		}
+		if err := r.options[i].validate(opts[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func accepted(options []OptionSpec) string {
+	if len(options) == 0 {
+		return " (none accepted)"
+	}
+	names := make([]string, len(options))
+	for i, o := range options {
+		names[i] = o.Name
+	}
+	return fmt.Sprintf(" (accepted: %s)", strings.Join(names, ", "))
+}
@@ -0,0 +1,391 @@
+// Package plugin provides signers backed by external plugin executables,
+// named ghait-provider-<name> and discovered on $PATH, speaking JSON-RPC 2.0
+// over their stdin and stdout.
+//
+// Each line written to a plugin's stdin is a Request, answered by a
+// Response on a line of its stdout. The methods are "check", verifying that
+// the key is usable, "public_key", returning the public key, and "sign",
+// returning the RS256 signature of a JWT signing input. A plugin serves
+// requests until its stdin is closed, and may log to stderr.
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/isometry/ghait/provider"
+)
+
+func init() {
+	// $PATH is searched on first use of the registry, once the built-in
+	// providers, which take precedence, are registered
+	provider.RegisterDiscoverer(func() map[string]provider.Discovered {
+		discovered := map[string]provider.Discovered{}
+		for name, path := range Discover(os.Getenv("PATH")) {
+			discovered[name] = provider.Discovered{Factory: factory(name, path), Options: options}
+		}
+		return discovered
+	})
+}
+
+// Prefix is the prefix of the names of plugin executables.
+const Prefix = "ghait-provider-"
+
+// DefaultTimeout is the default time allowed for a plugin to answer a request.
+const DefaultTimeout = 30 * time.Second
+
+// options are the provider options accepted by every plugin signer.
+var options = []provider.OptionSpec{
+	{Name: "timeout", Type: provider.Duration, Description: "Time allowed for the plugin to answer a request (default 30s)"},
+}
+
+// Discover returns the paths of the plugin executables found in the
+// directories of path, a list such as $PATH, by provider name. Where
+// several directories hold a plugin of the same name, the first wins.
+func Discover(path string) map[string]string {
+	plugins := map[string]string{}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), Prefix)
+			if runtime.GOOS == "windows" {
+				name = strings.TrimSuffix(name, ".exe")
+			}
+			if !ok || name == "" || plugins[name] != "" {
+				continue
+			}
+			file := filepath.Join(dir, entry.Name())
+			if info, err := os.Stat(file); err != nil || !executable(info) {
+				continue
+			}
+			plugins[name] = file
+		}
+	}
+	return plugins
+}
+
+func executable(info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0o111 != 0
+}
+
+// Register registers the plugin executable at path as the provider name.
+func Register(name, path string) {
+	provider.RegisterWithOptions(name, factory(name, path), options...)
+}
+
+// factory returns the factory of signers with the plugin executable at
+// path, registered as the provider name.
+func factory(name, path string) provider.Factory {
+	return func(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+		return NewSignerWithOptions(ctx, name, path, key, opts)
+	}
+}
+
+// pluginSigner implements provider.Provider with a plugin executable.
+type pluginSigner struct {
+	key     string
+	timeout time.Duration
+	client  *client
+
+	mu     sync.Mutex
+	public *rsa.PublicKey
+}
+
+// NewSignerWithOptions returns a new signer for key with the plugin
+// executable at path, registered as the provider name, configured by the
+// provider options opts, logging to the logger carried by ctx. The plugin is
+// started on first use, and restarted should it fail; close the signer (an
+// io.Closer) to stop it.
+func NewSignerWithOptions(ctx context.Context, name, path, key string, opts provider.Options) (provider.Provider, error) {
+	logger := provider.Logger(ctx).With("provider", name, "key", key)
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", name, err)
+	}
+
+	timeout := opts.Duration("timeout")
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &pluginSigner{
+		key:     key,
+		timeout: timeout,
+		client:  &client{name: name, path: path, logger: logger},
+	}, nil
+}
+
+// Check checks that the plugin accepts the key, and that its public key is
+// an RSA key.
+func (s *pluginSigner) Check(ctx context.Context) error {
+	if err := s.call(ctx, MethodCheck, KeyParams{Key: s.key}, nil); err != nil {
+		return err
+	}
+	_, err := s.publicKey(ctx)
+	return err
+}
+
+// SignContext signs the JWT claims with the plugin, verifying the signature
+// against the public key of the plugin.
+func (s *pluginSigner) SignContext(ctx context.Context, claims jwt.Claims) (string, error) {
+	public, err := s.publicKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	signingString, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SigningString()
+	if err != nil {
+		return "", err
+	}
+
+	var result SignResult
+	params := SignParams{Key: s.key, Algorithm: jwt.SigningMethodRS256.Alg(), SigningInput: signingString}
+	if err := s.call(ctx, MethodSign, params, &result); err != nil {
+		return "", err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(result.Signature)
+	if err != nil {
+		return "", fmt.Errorf("plugin %s: invalid signature encoding: %w", s.client.name, err)
+	}
+	digest := sha256.Sum256([]byte(signingString))
+	if err := rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature); err != nil {
+		return "", fmt.Errorf("plugin %s: signature does not match public key: %w", s.client.name, err)
+	}
+
+	return signingString + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// publicKey returns the public key of the plugin, fetched on first use.
+func (s *pluginSigner) publicKey(ctx context.Context) (*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.public != nil {
+		return s.public, nil
+	}
+
+	var result PublicKeyResult
+	if err := s.call(ctx, MethodPublicKey, KeyParams{Key: s.key}, &result); err != nil {
+		return nil, err
+	}
+	public, err := parsePublicKey([]byte(result.PublicKey))
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", s.client.name, err)
+	}
+	s.public = public
+	return public, nil
+}
+
+// call calls method of the plugin within ctx, bounded by the signer timeout.
+func (s *pluginSigner) call(ctx context.Context, method string, params, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.client.call(ctx, method, params, result)
+}
+
+// Close stops the plugin.
+func (s *pluginSigner) Close() error {
+	return s.client.close()
+}
+
+func parsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode public key")
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+		return public, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+// client calls a plugin process, started on demand and serving one request
+// at a time.
+type client struct {
+	name   string
+	path   string
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	nextID uint64
+}
+
+// call sends a request for method to the plugin, decoding its result into
+// result if non-nil. Should the plugin fail to answer, or ctx be done
+// first, the plugin is stopped, to be restarted by the next call.
+func (c *client) call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cmd == nil {
+		if err := c.start(); err != nil {
+			return fmt.Errorf("plugin %s: failed to start: %w", c.name, err)
+		}
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	c.nextID++
+	request, err := json.Marshal(Request{JSONRPC: "2.0", ID: c.nextID, Method: method, Params: encoded})
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	var response Response
+	go func() {
+		if _, err := c.stdin.Write(append(request, '\n')); err != nil {
+			done <- err
+			return
+		}
+		line, err := c.stdout.ReadBytes('\n')
+		if err != nil {
+			done <- err
+			return
+		}
+		done <- json.Unmarshal(line, &response)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		c.stop()
+		<-done
+		return fmt.Errorf("plugin %s: %s: %w", c.name, method, ctx.Err())
+	}
+
+	if err == nil && response.ID != c.nextID {
+		err = fmt.Errorf("response id %d does not match request id %d", response.ID, c.nextID)
+	}
+	if err != nil {
+		c.stop()
+		return fmt.Errorf("plugin %s: %s: %w", c.name, method, err)
+	}
+
+	if response.Error != nil {
+		return fmt.Errorf("plugin %s: %s: %w", c.name, method, response.Error)
+	}
+	if result != nil {
+		if err := json.Unmarshal(response.Result, result); err != nil {
+			return fmt.Errorf("plugin %s: %s: invalid result: %w", c.name, method, err)
+		}
+	}
+	return nil
+}
+
+// start starts the plugin process; c.mu must be held.
+func (c *client) start() error {
+	cmd := exec.Command(c.path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				c.logger.Info("plugin output", "stderr", string(line))
+			}
+		}
+	}()
+
+	c.cmd, c.stdin, c.stdout = cmd, stdin, bufio.NewReader(stdout)
+	c.logger.Debug("started plugin", "path", c.path, "pid", cmd.Process.Pid)
+	return nil
+}
+
+// stop stops the plugin process, if running; c.mu must be held.
+func (c *client) stop() {
+	if c.cmd == nil {
+		return
+	}
+	_ = c.stdin.Close()
+	_ = c.cmd.Process.Kill()
+	_ = c.cmd.Wait()
+	c.cmd, c.stdin, c.stdout = nil, nil, nil
+}
+
+// close stops the plugin process, giving it the chance to exit once its
+// stdin is closed.
+func (c *client) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cmd == nil {
+		return nil
+	}
+	_ = c.stdin.Close()
+
+	exited := make(chan error, 1)
+	go func() { exited <- c.cmd.Wait() }()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		_ = c.cmd.Process.Kill()
+		<-exited
+	}
+	c.cmd, c.stdin, c.stdout = nil, nil, nil
+	return nil
+}
@@ -0,0 +1,220 @@
+package plugin_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/keysource"
+	"github.com/isometry/ghait/provider/plugin"
+)
+
+// TestMain serves as the test plugin when the test binary is run through
+// a link named for a plugin.
+func TestMain(m *testing.M) {
+	if strings.HasPrefix(filepath.Base(os.Args[0]), plugin.Prefix) {
+		if err := plugin.Serve(context.Background(), os.Stdin, os.Stdout, fileHandler{}); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fileHandler is a plugin signing with the RSA key held in the file named
+// by key, misbehaving as directed by $GHAIT_TEST_PLUGIN_MODE.
+type fileHandler struct{}
+
+func (fileHandler) load(key string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(key)
+	if err != nil {
+		return nil, errors.New("no such key")
+	}
+	return keysource.ParsePrivateKey(data)
+}
+
+func (h fileHandler) Check(_ context.Context, key string) error {
+	_, err := h.load(key)
+	return err
+}
+
+func (h fileHandler) PublicKey(_ context.Context, key string) ([]byte, error) {
+	private, err := h.load(key)
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv("GHAIT_TEST_PLUGIN_MODE") == "mismatch" {
+		if private, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return nil, err
+		}
+	}
+	der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+func (h fileHandler) Sign(_ context.Context, key string, signingInput []byte) ([]byte, error) {
+	if os.Getenv("GHAIT_TEST_PLUGIN_MODE") == "hang" {
+		time.Sleep(time.Minute)
+	}
+	private, err := h.load(key)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(signingInput)
+	return rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+}
+
+// installPlugin links the test binary into a new directory as the plugin
+// name, returning the directory.
+func installPlugin(t *testing.T, name string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugin requires symbolic links")
+	}
+
+	self, err := os.Executable()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Symlink(self, filepath.Join(dir, plugin.Prefix+name)))
+	return dir
+}
+
+// writeKey writes a new private key to a file, returning the key and the
+// path of the file.
+func writeKey(t *testing.T) (*ghaittest.Provider, string) {
+	t.Helper()
+
+	key, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, key.PrivateKeyPEM(), 0o600))
+	return key, path
+}
+
+func TestDiscover(t *testing.T) {
+	dir := installPlugin(t, "test")
+	other := installPlugin(t, "test")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, plugin.Prefix+"noexec"), nil, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ghait"), nil, 0o700))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, plugin.Prefix+"dir"), 0o700))
+
+	path := strings.Join([]string{"", filepath.Join(dir, "missing"), dir, other}, string(os.PathListSeparator))
+	assert.Equal(t, map[string]string{"test": filepath.Join(dir, plugin.Prefix+"test")}, plugin.Discover(path))
+}
+
+func TestPluginSigner(t *testing.T) {
+	dir := installPlugin(t, "test")
+	plugin.Register("test-plugin", filepath.Join(dir, plugin.Prefix+"test"))
+	key, keyFile := writeKey(t)
+
+	for _, k := range []string{keyFile, "test-plugin://" + keyFile + "?timeout=5s"} {
+		t.Run(k, func(t *testing.T) {
+			signer, err := provider.NewSignerWithOptions(context.Background(), "test-plugin", k, nil)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, signer.(io.Closer).Close()) }()
+			require.NoError(t, signer.Check(context.Background()))
+
+			for range 2 {
+				signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+				require.NoError(t, err)
+
+				parsed, err := jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, func(*jwt.Token) (any, error) {
+					return key.PublicKey(), nil
+				}, jwt.WithValidMethods([]string{"RS256"}))
+				require.NoError(t, err)
+				assert.Equal(t, "12345", parsed.Claims.(*jwt.RegisteredClaims).Issuer)
+			}
+		})
+	}
+}
+
+func TestPluginSigner_Errors(t *testing.T) {
+	dir := installPlugin(t, "test")
+	plugin.Register("test-plugin", filepath.Join(dir, plugin.Prefix+"test"))
+	_, keyFile := writeKey(t)
+
+	t.Run("unknown key", func(t *testing.T) {
+		signer, err := provider.NewSignerWithOptions(context.Background(), "test-plugin", filepath.Join(dir, "missing.pem"), nil)
+		require.NoError(t, err)
+		defer signer.(io.Closer).Close()
+
+		assert.ErrorContains(t, signer.Check(context.Background()), "plugin test-plugin: check: no such key")
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		t.Setenv("GHAIT_TEST_PLUGIN_MODE", "mismatch")
+		signer, err := provider.NewSignerWithOptions(context.Background(), "test-plugin", keyFile, nil)
+		require.NoError(t, err)
+		defer signer.(io.Closer).Close()
+
+		_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		assert.ErrorContains(t, err, "signature does not match public key")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Setenv("GHAIT_TEST_PLUGIN_MODE", "hang")
+		signer, err := provider.NewSignerWithOptions(context.Background(), "test-plugin", keyFile, provider.Options{"timeout": "200ms"})
+		require.NoError(t, err)
+		defer signer.(io.Closer).Close()
+
+		_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		assert.ErrorContains(t, err, "plugin test-plugin: sign: context deadline exceeded")
+
+		// the plugin is restarted, still hanging
+		_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		assert.ErrorContains(t, err, "context deadline exceeded")
+	})
+
+	t.Run("missing executable", func(t *testing.T) {
+		plugin.Register("test-missing", filepath.Join(dir, plugin.Prefix+"missing"))
+		_, err := provider.NewSigner(context.Background(), "test-missing", keyFile)
+		assert.ErrorContains(t, err, "plugin test-missing")
+	})
+}
+
+func TestServe(t *testing.T) {
+	_, keyFile := writeKey(t)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"check","params":{"key":"` + keyFile + `"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"sign","params":{"key":"` + keyFile + `","algorithm":"ES256","signing_input":"a.b"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"decrypt","params":{}}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":5,"method":"check","params":{"key":"missing"}}`,
+	}, "\n")
+
+	var output strings.Builder
+	require.NoError(t, plugin.Serve(context.Background(), strings.NewReader(input), &output, fileHandler{}))
+
+	assert.Equal(t, strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"result":{}}`,
+		`{"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"unsupported algorithm \"ES256\""}}`,
+		`{"jsonrpc":"2.0","id":3,"error":{"code":-32601,"message":"method \"decrypt\" not found"}}`,
+		`{"jsonrpc":"2.0","id":0,"error":{"code":-32700,"message":"invalid character 'o' in literal null (expecting 'u')"}}`,
+		`{"jsonrpc":"2.0","id":5,"error":{"code":-32603,"message":"no such key"}}`,
+		``,
+	}, "\n"), output.String())
+}
@@ -0,0 +1,76 @@
+package plugin
+
+import "encoding/json"
+
+// Methods of the plugin protocol.
+const (
+	MethodCheck     = "check"
+	MethodSign      = "sign"
+	MethodPublicKey = "public_key"
+)
+
+// Error codes of the plugin protocol, as defined by JSON-RPC 2.0.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Request is a JSON-RPC 2.0 request sent to a plugin, one per line on its
+// stdin.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC 2.0 response written by a plugin, one per line on
+// its stdout.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      uint64          `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is a JSON-RPC 2.0 error.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// KeyParams are the parameters of the check and public_key methods.
+type KeyParams struct {
+	// Key identifies the signing key, as given to ghait.
+	Key string `json:"key"`
+}
+
+// SignParams are the parameters of the sign method.
+type SignParams struct {
+	// Key identifies the signing key, as given to ghait.
+	Key string `json:"key"`
+	// Algorithm is the JWT signing algorithm, always "RS256".
+	Algorithm string `json:"algorithm"`
+	// SigningInput is the JWT signing input, "<header>.<payload>", to be
+	// signed with RSASSA-PKCS1-v1_5 using SHA-256.
+	SigningInput string `json:"signing_input"`
+}
+
+// SignResult is the result of the sign method.
+type SignResult struct {
+	// Signature is the standard base64 encoded signature.
+	Signature string `json:"signature"`
+}
+
+// PublicKeyResult is the result of the public_key method.
+type PublicKeyResult struct {
+	// PublicKey is the PEM encoded PKIX or PKCS #1 RSA public key.
+	PublicKey string `json:"public_key"`
+}
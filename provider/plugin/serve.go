@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Handler implements the methods of a plugin written in Go.
+type Handler interface {
+	// Check returns an error if key is not usable for signing.
+	Check(ctx context.Context, key string) error
+	// PublicKey returns the PEM encoded public key of key.
+	PublicKey(ctx context.Context, key string) ([]byte, error)
+	// Sign returns the RSASSA-PKCS1-v1_5 SHA-256 signature of signingInput
+	// made with key.
+	Sign(ctx context.Context, key string, signingInput []byte) ([]byte, error)
+}
+
+// Serve serves requests read from r, typically os.Stdin, with h, writing
+// responses to w, typically os.Stdout, until r is exhausted or ctx is done.
+// Errors returned by h are answered as internal errors carrying their
+// message.
+func Serve(ctx context.Context, r io.Reader, w io.Writer, h Handler) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	encoder := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var request Request
+		var response Response
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			response.Error = &Error{Code: CodeParseError, Message: err.Error()}
+		} else {
+			response.ID = request.ID
+			response.Result, response.Error = handle(ctx, h, request)
+		}
+
+		response.JSONRPC = "2.0"
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func handle(ctx context.Context, h Handler, request Request) (json.RawMessage, *Error) {
+	var result any
+	switch request.Method {
+	case MethodCheck:
+		var params KeyParams
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		if err := h.Check(ctx, params.Key); err != nil {
+			return nil, internalError(err)
+		}
+		result = struct{}{}
+
+	case MethodPublicKey:
+		var params KeyParams
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		public, err := h.PublicKey(ctx, params.Key)
+		if err != nil {
+			return nil, internalError(err)
+		}
+		result = PublicKeyResult{PublicKey: string(public)}
+
+	case MethodSign:
+		var params SignParams
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		if params.Algorithm != "RS256" {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("unsupported algorithm %q", params.Algorithm)}
+		}
+		signature, err := h.Sign(ctx, params.Key, []byte(params.SigningInput))
+		if err != nil {
+			return nil, internalError(err)
+		}
+		result = SignResult{Signature: base64.StdEncoding.EncodeToString(signature)}
+
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", request.Method)}
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, internalError(err)
+	}
+	return encoded, nil
+}
+
+func internalError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &Error{Code: CodeInternalError, Message: err.Error()}
+}
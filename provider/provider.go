@@ -4,6 +4,10 @@ package provider
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -13,33 +17,137 @@ import (
 var ErrUnsupportedProvider = errors.New("unsupported provider")
 
 // Provider is the interface that must be implemented by all token providers.
+// Providers must not retain the context passed to their constructor: every
+// remote call is made within the context of the method invoking it.
 type Provider interface {
 	// Check checks the validity of the signer, returning an error if the signer
 	// is invalid or misconfigured.
-	Check() error
+	Check(ctx context.Context) error
 
-	// Sign signs the given claims and returns a JWT token string, as specified
-	// by [jwt.Token.SignedString]
-	Sign(claims jwt.Claims) (string, error)
+	// SignContext signs the given claims within ctx and returns a JWT token
+	// string, as specified by [jwt.Token.SignedString]
+	SignContext(ctx context.Context, claims jwt.Claims) (string, error)
 }
 
-type providerRegistry map[string]func(ctx context.Context, key string) (Provider, error)
+// ContextSigner adapts a Provider to the ghinstallation.Signer interface,
+// signing within a context supplied per call.
+type ContextSigner struct {
+	Provider Provider
+	// Context returns the context within which to sign, defaulting to
+	// context.Background if nil.
+	Context func() context.Context
+}
+
+// NewContextSigner returns a ContextSigner signing with p within the
+// context returned by ctx for each call.
+func NewContextSigner(p Provider, ctx func() context.Context) *ContextSigner {
+	return &ContextSigner{Provider: p, Context: ctx}
+}
+
+// Sign signs the given claims with the wrapped provider, implementing
+// ghinstallation.Signer.
+func (s *ContextSigner) Sign(claims jwt.Claims) (string, error) {
+	ctx := context.Background()
+	if s.Context != nil {
+		ctx = s.Context()
+	}
+	return s.Provider.SignContext(ctx, claims)
+}
+
+// Factory creates a provider signing with key, configured by opts.
+type Factory func(ctx context.Context, key string, opts Options) (Provider, error)
+
+type registration struct {
+	newSigner Factory
+	options   []OptionSpec
+}
+
+type providerRegistry map[string]registration
 
 var (
 	registry = providerRegistry{}
 	mu       sync.RWMutex
+
+	// discoverers are the registered discoverers, of which the first
+	// discovered have been run; guarded by mu.
+	discoverers []DiscoverFunc
+	discovered  int
 )
 
-// Register registers a new provider.
+// Discovered is a provider found by a DiscoverFunc.
+type Discovered struct {
+	Factory Factory
+	Options []OptionSpec
+}
+
+// DiscoverFunc returns the providers found outside the process, such as
+// plugin executables, by name. It must not call into this package.
+type DiscoverFunc func() map[string]Discovered
+
+// RegisterDiscoverer registers discover, to be run once on the next use of
+// the registry, rather than on registration, so that merely importing a
+// package registering a discoverer has no side effects. Providers registered
+// by name take precedence over those discovered, whenever registered.
+func RegisterDiscoverer(discover DiscoverFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	discoverers = append(discoverers, discover)
+}
+
+// discover runs the discoverers yet to be run, registering the providers
+// they find under names not already registered.
+func discover() {
+	mu.RLock()
+	pending := discovered < len(discoverers)
+	mu.RUnlock()
+	if !pending {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for ; discovered < len(discoverers); discovered++ {
+		for name, d := range discoverers[discovered]() {
+			if _, ok := registry[name]; !ok {
+				registry[name] = registration{newSigner: d.Factory, options: d.Options}
+			}
+		}
+	}
+}
+
+// lookup returns the registration of the named provider, running any
+// pending discoverers first.
+func lookup(name string) (registration, bool) {
+	discover()
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	r, ok := registry[name]
+	return r, ok
+}
+
+// Register registers a new provider accepting no options.
 func Register(name string, newSigner func(ctx context.Context, key string) (Provider, error)) {
+	RegisterWithOptions(name, func(ctx context.Context, key string, _ Options) (Provider, error) {
+		return newSigner(ctx, key)
+	})
+}
+
+// RegisterWithOptions registers a new provider accepting the declared options.
+func RegisterWithOptions(name string, newSigner Factory, options ...OptionSpec) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	registry[name] = newSigner
+	registry[name] = registration{newSigner: newSigner, options: options}
 }
 
-// Registered returns a list of all registered providers.
+// Registered returns a list of all registered and discovered providers.
 func Registered() []string {
+	discover()
+
 	mu.RLock()
 	defer mu.RUnlock()
 
@@ -50,15 +158,85 @@ func Registered() []string {
 	return keys
 }
 
+// OptionSpecs returns the options accepted by the named provider.
+func OptionSpecs(provider string) []OptionSpec {
+	r, _ := lookup(provider)
+	return slices.Clone(r.options)
+}
+
 // NewSigner creates a new signer for the given provider.
 func NewSigner(ctx context.Context, provider, key string) (Provider, error) {
-	mu.RLock()
-	defer mu.RUnlock()
+	return NewSignerWithOptions(ctx, provider, key, nil)
+}
+
+// NewSignerWithOptions creates a new signer for the given provider,
+// configured by opts, which are first validated against the options
+// declared by the provider.
+//
+// If key is a key URI, as parsed by ParseURI, the signer is created by the
+// provider of its scheme, which provider must match if non-empty, with the
+// options of its query taking precedence over opts.
+func NewSignerWithOptions(ctx context.Context, provider, key string, opts Options) (Provider, error) {
+	if IsURI(key) {
+		name, uriKey, uriOpts, err := ParseURI(key)
+		if err != nil {
+			return nil, err
+		}
+		if provider != "" && provider != name {
+			return nil, fmt.Errorf("provider %s does not match key URI for provider %s", provider, name)
+		}
+		provider, key = name, uriKey
+		if len(uriOpts) > 0 {
+			opts = maps.Clone(opts)
+			if opts == nil {
+				opts = Options{}
+			}
+			maps.Copy(opts, uriOpts)
+		}
+	}
 
-	newSigner, ok := registry[provider]
+	r, ok := lookup(provider)
 	if !ok {
 		return nil, ErrUnsupportedProvider
 	}
 
-	return newSigner(ctx, key)
+	if err := ValidateOptions(provider, opts); err != nil {
+		return nil, err
+	}
+
+	if opts == nil {
+		opts = Options{}
+	}
+	return r.newSigner(ctx, key, opts)
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying the logger for providers created
+// through NewSigner.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// Logger returns the logger carried by ctx, or a logger that discards all
+// output if there is none.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+type appIDKey struct{}
+
+// WithAppID returns a copy of ctx carrying the ID of the GitHub App for which
+// a provider is checked, for providers able to verify it.
+func WithAppID(ctx context.Context, appID int64) context.Context {
+	return context.WithValue(ctx, appIDKey{}, appID)
+}
+
+// AppID returns the GitHub App ID carried by ctx, or 0 if there is none.
+func AppID(ctx context.Context) int64 {
+	appID, _ := ctx.Value(appIDKey{}).(int64)
+	return appID
 }
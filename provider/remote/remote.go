@@ -0,0 +1,168 @@
+// Package remote provides a signer calling a ghait signing server, as
+// served by `ghait signer serve`, over mutual TLS.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/signer"
+)
+
+func init() {
+	provider.RegisterWithOptions("remote", NewSignerWithOptions, options...)
+}
+
+// DefaultTimeout is the default time allowed for a request to the signing
+// server.
+const DefaultTimeout = 10 * time.Second
+
+// options are the provider options accepted by the remote signer.
+var options = []provider.OptionSpec{
+	{Name: "cert_file", Description: "PEM file holding the client certificate (required)"},
+	{Name: "key_file", Description: "PEM file holding the client private key (required)"},
+	{Name: "ca_file", Description: "PEM file holding the CA certificates verifying the server (default system roots)"},
+	{Name: "server_name", Description: "Server name verified against the server certificate (default host of the key)"},
+	{Name: "timeout", Type: provider.Duration, Description: "Time allowed for a request to the signing server (default 10s)"},
+}
+
+// remoteSigner implements provider.Provider by calling a signing server.
+type remoteSigner struct {
+	url    *url.URL
+	client *http.Client
+}
+
+// NewSigner returns a new remote signer with default configuration,
+// logging to the logger carried by ctx.
+func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
+	return NewSignerWithOptions(ctx, key, nil)
+}
+
+// NewSignerWithOptions returns a new signer calling the signing server at
+// key, a URL such as "https://signer.example.com:8443" or a host and port,
+// configured by the provider options opts.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	logger := provider.Logger(ctx).With("provider", "remote", "key", key)
+
+	if !strings.Contains(key, "://") {
+		key = "https://" + key
+	}
+	u, err := url.Parse(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing server URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid signing server URL %q: expected https://<host>[:<port>]", key)
+	}
+
+	if opts.String("cert_file") == "" || opts.String("key_file") == "" {
+		return nil, errors.New("cert_file and key_file options are required")
+	}
+	tlsConfig, err := signer.ClientTLSConfig(opts.String("cert_file"), opts.String("key_file"), opts.String("ca_file"), opts.String("server_name"))
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := opts.Duration("timeout")
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	logger.Debug("created remote signer", "url", u.String())
+	return NewRemoteSignerWithClient(u, &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		Timeout:   timeout,
+	}), nil
+}
+
+// NewRemoteSignerWithClient returns a new signer calling the signing server
+// at u with client, which must present a client certificate.
+func NewRemoteSignerWithClient(u *url.URL, client *http.Client) provider.Provider {
+	return &remoteSigner{url: u, client: client}
+}
+
+// Check checks that the signing server authorizes the client, and signs for
+// the app ID carried by ctx, if any.
+func (s *remoteSigner) Check(ctx context.Context) error {
+	var response signer.CheckResponse
+	if err := s.do(ctx, http.MethodGet, signer.CheckPath, nil, &response); err != nil {
+		return err
+	}
+	if appID := provider.AppID(ctx); appID != 0 && !slices.Contains(response.AppIDs, appID) {
+		return fmt.Errorf("signing server does not sign for app ID %d", appID)
+	}
+	return nil
+}
+
+// SignContext has the signing server sign the JWT claims, which must be
+// those of a GitHub App JWT.
+func (s *remoteSigner) SignContext(ctx context.Context, claims jwt.Claims) (string, error) {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	var request signer.SignRequest
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request.Claims); err != nil {
+		return "", fmt.Errorf("unsupported claims: %w", err)
+	}
+
+	var response signer.SignResponse
+	if err := s.do(ctx, http.MethodPost, signer.SignPath, request, &response); err != nil {
+		return "", err
+	}
+	return response.Token, nil
+}
+
+// do makes a request to path of the signing server, sending body as JSON
+// if non-nil, and decoding the response into result.
+func (s *remoteSigner) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.url.JoinPath(path).String(), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("signing server: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		var e signer.ErrorResponse
+		if err := decoder.Decode(&e); err != nil || e.Error == "" {
+			return fmt.Errorf("signing server: %s", resp.Status)
+		}
+		return fmt.Errorf("signing server: %s: %s", resp.Status, e.Error)
+	}
+	if err := decoder.Decode(result); err != nil {
+		return fmt.Errorf("signing server: invalid response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package remote_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider"
+	_ "github.com/isometry/ghait/provider/remote"
+	"github.com/isometry/ghait/signer"
+	"github.com/isometry/ghait/signer/signertest"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	p, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+	handler, err := signer.NewHandler(p, signer.Config{AppIDs: []int64{12345}, Clients: []string{"ci-runner"}}, nil)
+	require.NoError(t, err)
+
+	server, err := signertest.NewServer(handler)
+	require.NoError(t, err)
+	defer server.Close()
+
+	certFile, keyFile, err := server.IssueClient("ci-runner")
+	require.NoError(t, err)
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	tests := map[string]struct {
+		key     string
+		options provider.Options
+		err     string
+	}{
+		"url":          {key: server.URL, options: provider.Options{"cert_file": certFile, "key_file": keyFile, "ca_file": server.CAFile}},
+		"host":         {key: host, options: provider.Options{"cert_file": certFile, "key_file": keyFile, "ca_file": server.CAFile}},
+		"uri":          {key: "remote://" + host + "?timeout=5s&server_name=example.com", options: provider.Options{"cert_file": certFile, "key_file": keyFile, "ca_file": server.CAFile}},
+		"plain http":   {key: "http://" + host, options: provider.Options{"cert_file": certFile, "key_file": keyFile}, err: "expected https://<host>[:<port>]"},
+		"missing cert": {key: server.URL, options: provider.Options{"ca_file": server.CAFile}, err: "cert_file and key_file options are required"},
+		"invalid cert": {key: server.URL, options: provider.Options{"cert_file": keyFile, "key_file": keyFile}, err: "load client certificate"},
+		"invalid CA":   {key: server.URL, options: provider.Options{"cert_file": certFile, "key_file": keyFile, "ca_file": keyFile}, err: "no certificates found"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			remote, err := provider.NewSignerWithOptions(context.Background(), "remote", tt.key, tt.options)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NoError(t, remote.Check(context.Background()))
+			require.NoError(t, remote.Check(provider.WithAppID(context.Background(), 12345)))
+			assert.EqualError(t, remote.Check(provider.WithAppID(context.Background(), 54321)), "signing server does not sign for app ID 54321")
+
+			now := time.Now()
+			signed, err := remote.SignContext(context.Background(), &jwt.RegisteredClaims{
+				Issuer:    "12345",
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return p.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+}
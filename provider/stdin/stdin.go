@@ -2,58 +2,187 @@
 package stdin
 
 import (
+	"bytes"
 	"context"
 	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"strings"
+	"io"
+	"os"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/term"
 
 	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/keysource"
 )
 
 func init() {
-	provider.Register("stdin", NewSigner)
+	provider.RegisterWithOptions("stdin", NewSignerWithOptions, options...)
 }
 
-// stdinSigner implements provider.Provider & ghinstallation.Signer with the RSA key retrieved from stdin.
+const (
+	// DefaultTimeout is the default time allowed for the key to be read.
+	DefaultTimeout = time.Minute
+	// MaxKeySize is the maximum size of the key read from stdin, ample
+	// for a PEM encoded 4096-bit RSA key.
+	MaxKeySize = 16 << 10
+)
+
+// options are the provider options accepted by the stdin signer.
+var options = []provider.OptionSpec{
+	{Name: "timeout", Type: provider.Duration, Description: "Time allowed for the key to be read from stdin (default 1m)"},
+}
+
+// endMarker marks the final line of a PEM encoded key.
+var endMarker = []byte("-----END ")
+
+// stdinSigner implements provider.Provider with the RSA key retrieved from stdin.
 type stdinSigner struct {
-	context context.Context
-	key     *rsa.PrivateKey
+	key *rsa.PrivateKey
 }
 
-// NewSigner creates a new file signer.
+// NewSigner creates a new stdin signer with default configuration.
 func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
-	keyBytes := []byte(strings.TrimSpace(key))
-	if len(keyBytes) == 0 {
-		return nil, errors.New("empty key")
-	}
+	return NewSignerWithOptions(ctx, key, nil)
+}
 
-	block, _ := pem.Decode(keyBytes)
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
-		return nil, errors.New("failed to decode RSA private key")
+// NewSignerWithOptions creates a new stdin signer, configured by the provider
+// options opts. If key is empty or "-", the PEM encoded key is read from
+// os.Stdin, prompting for it without echo if stdin is a terminal; otherwise
+// key is the PEM encoded key itself.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	var keyBytes []byte
+	if key == "" || key == "-" {
+		timeout := opts.Duration("timeout")
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+
+		var err error
+		if keyBytes, err = readStdin(ctx, timeout); err != nil {
+			return nil, err
+		}
+	} else {
+		keyBytes = []byte(key)
 	}
+	defer clear(keyBytes)
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	privateKey, err := keysource.ParsePrivateKey(bytes.TrimSpace(keyBytes))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse RSA private key: %w", err)
+		return nil, err
 	}
 
 	return &stdinSigner{
-		context: ctx,
-		key:     privateKey,
+		key: privateKey,
 	}, nil
 }
 
-func (s *stdinSigner) Check() error {
+func (s *stdinSigner) Check(context.Context) error {
 	// validated within NewSigner
 	return nil
 }
 
-// Sign signs the JWT claims with the RSA key.
-func (s *stdinSigner) Sign(claims jwt.Claims) (string, error) {
+// SignContext signs the JWT claims with the RSA key.
+func (s *stdinSigner) SignContext(_ context.Context, claims jwt.Claims) (string, error) {
 	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(s.key)
 }
+
+type result struct {
+	data []byte
+	err  error
+}
+
+// readStdin reads the key from os.Stdin, giving up once timeout elapses or
+// ctx is done. A read blocked on stdin cannot be interrupted, so is then
+// abandoned, any key it later reads being cleared.
+func readStdin(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdin := os.Stdin
+	read := func() ([]byte, error) { return readAll(stdin) }
+
+	if fd := int(stdin.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to disable echo: %w", err)
+		}
+		defer func() { _ = term.Restore(fd, state) }()
+
+		_, _ = fmt.Fprint(os.Stderr, "Enter the GitHub App private key (input hidden): ")
+		defer func() { _, _ = fmt.Fprint(os.Stderr, "\r\n") }()
+		read = func() ([]byte, error) { return readTerminal(stdin) }
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		data, err := read()
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			clear(r.data)
+			return nil, fmt.Errorf("failed to read key from stdin: %w", r.err)
+		}
+		return r.data, nil
+	case <-ctx.Done():
+		go func() { clear((<-done).data) }()
+		return nil, fmt.Errorf("failed to read key from stdin: %w", ctx.Err())
+	}
+}
+
+// readAll reads r to EOF, up to MaxKeySize bytes, into a buffer allocated
+// once, so that no copies of the key are left behind to be cleared.
+func readAll(r io.Reader) ([]byte, error) {
+	data := make([]byte, MaxKeySize+1)
+	n, err := io.ReadFull(r, data)
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return data[:n], nil
+	case err != nil:
+		return data[:n], err
+	default:
+		return data, fmt.Errorf("key exceeds %d bytes", MaxKeySize)
+	}
+}
+
+// readTerminal reads a PEM encoded key from the raw mode terminal r, up to
+// and including its end marker line, up to MaxKeySize bytes, into a buffer
+// allocated once. Carriage returns are read as newlines, Ctrl-C aborts and
+// Ctrl-D ends the input.
+func readTerminal(r io.Reader) ([]byte, error) {
+	data := make([]byte, 0, MaxKeySize+1)
+	line := 0
+	b := make([]byte, 1)
+	for {
+		if _, err := r.Read(b); err != nil {
+			if errors.Is(err, io.EOF) {
+				return data, nil
+			}
+			return data, err
+		}
+
+		switch c := b[0]; c {
+		case 0x03:
+			return data, errors.New("interrupted")
+		case 0x04:
+			return data, nil
+		case '\r', '\n':
+			data = append(data, '\n')
+			if bytes.HasPrefix(bytes.TrimSpace(data[line:]), endMarker) {
+				return data, nil
+			}
+			line = len(data)
+		default:
+			data = append(data, c)
+		}
+
+		if len(data) > MaxKeySize {
+			return data, fmt.Errorf("key exceeds %d bytes", MaxKeySize)
+		}
+	}
+}
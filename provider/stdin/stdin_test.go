@@ -0,0 +1,84 @@
+package stdin_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/stdin"
+)
+
+// setStdin replaces os.Stdin with a pipe for the duration of the test,
+// returning its write end.
+func setStdin(t *testing.T) *os.File {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = r.Close()
+		_ = w.Close()
+	})
+
+	orig := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() { os.Stdin = orig })
+	return w
+}
+
+func TestStdinSigner(t *testing.T) {
+	key, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		key   string
+		input string
+		err   string
+	}{
+		"dash":        {key: "-", input: string(key.PrivateKeyPEM())},
+		"empty":       {key: "", input: "\n" + string(key.PrivateKeyPEM()) + "\n"},
+		"literal":     {key: string(key.PrivateKeyPEM())},
+		"invalid key": {key: "-", input: "not a key", err: "failed to decode RSA private key"},
+		"empty input": {key: "-", err: "empty key"},
+		"too large":   {key: "-", input: strings.Repeat("x", stdin.MaxKeySize+1), err: "key exceeds"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := setStdin(t)
+			go func() {
+				_, _ = w.WriteString(tt.input)
+				_ = w.Close()
+			}()
+
+			signer, err := provider.NewSignerWithOptions(context.Background(), "stdin", tt.key, nil)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return key.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestStdinSigner_Timeout(t *testing.T) {
+	setStdin(t)
+
+	_, err := provider.NewSignerWithOptions(context.Background(), "stdin", "-", provider.Options{"timeout": "50ms"})
+	assert.ErrorContains(t, err, "context deadline exceeded")
+}
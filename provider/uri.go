@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// schemeRegexp matches a URI scheme, as specified by RFC 3986.
+var schemeRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*$`)
+
+type scheme struct {
+	provider string
+	key      func(ref string) string
+}
+
+// schemes holds the registered URI schemes by name; guarded by mu.
+var schemes = map[string]scheme{}
+
+// RegisterScheme registers scheme for key URIs of the named provider. If key
+// is non-nil, it derives the provider key from the reference of the URI, the
+// part between "<scheme>://" and any query; otherwise the reference is the
+// key. Schemes matching a provider name need not be registered.
+func RegisterScheme(name, provider string, key func(ref string) string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	schemes[strings.ToLower(name)] = scheme{provider: provider, key: key}
+}
+
+// lookupScheme returns the scheme registered under name, or else that of
+// the provider of the same name; mu must be held.
+func lookupScheme(name string) (scheme, bool) {
+	name = strings.ToLower(name)
+	if s, ok := schemes[name]; ok {
+		return s, true
+	}
+	if _, ok := registry[name]; ok {
+		return scheme{provider: name}, true
+	}
+	return scheme{}, false
+}
+
+// IsURI reports whether key is a key URI with a registered scheme.
+func IsURI(key string) bool {
+	name, _, ok := strings.Cut(key, "://")
+	if !ok || !schemeRegexp.MatchString(name) {
+		return false
+	}
+
+	discover()
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	_, ok = lookupScheme(name)
+	return ok
+}
+
+// ParseURI parses a key URI of the form
+// "<scheme>://<reference>[?<option>=<value>&...]", such as
+// "awskms://alias/github?region=eu-west-1", returning the provider of the
+// scheme, the key given by the reference, and the options given by the
+// query parameters.
+func ParseURI(uri string) (provider, key string, opts Options, err error) {
+	name, rest, ok := strings.Cut(uri, "://")
+	if !ok || !schemeRegexp.MatchString(name) {
+		return "", "", nil, fmt.Errorf("invalid key URI %q: expected <scheme>://<reference>", uri)
+	}
+
+	discover()
+
+	mu.RLock()
+	s, ok := lookupScheme(name)
+	mu.RUnlock()
+	if !ok {
+		return "", "", nil, fmt.Errorf("%w: URI scheme %q", ErrUnsupportedProvider, name)
+	}
+
+	ref, query, _ := strings.Cut(rest, "?")
+	if ref, err = url.PathUnescape(ref); err != nil {
+		return "", "", nil, fmt.Errorf("invalid key URI reference: %w", err)
+	}
+	if ref == "" {
+		return "", "", nil, fmt.Errorf("invalid key URI %q: empty reference", uri)
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid key URI query: %w", err)
+	}
+	opts = make(Options, len(values))
+	var errs []error
+	for _, option := range slices.Sorted(maps.Keys(values)) {
+		if len(values[option]) > 1 {
+			errs = append(errs, fmt.Errorf("option %q given more than once", option))
+			continue
+		}
+		opts[option] = values[option][0]
+	}
+	if err := errors.Join(errs...); err != nil {
+		return "", "", nil, fmt.Errorf("invalid key URI query: %w", err)
+	}
+
+	key = ref
+	if s.key != nil {
+		key = s.key(ref)
+	}
+	return s.provider, key, opts, nil
+}
@@ -0,0 +1,284 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+
+	vault "github.com/hashicorp/vault/api"
+
+	"github.com/isometry/ghait/provider"
+)
+
+// Auth methods selectable with the auth_method provider option.
+const (
+	AuthToken      = "token"
+	AuthKubernetes = "kubernetes"
+	AuthAppRole    = "approle"
+	AuthJWT        = "jwt"
+	AuthAWS        = "aws"
+)
+
+// DefaultKubernetesTokenPath is the path of the Kubernetes service account
+// token used by the kubernetes auth method.
+const DefaultKubernetesTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// reloginInterval is the delay between failed attempts to log in again
+// after the Vault token could no longer be renewed.
+var reloginInterval = 10 * time.Second
+
+// AuthFunc implements vault.AuthMethod with a function.
+type AuthFunc func(ctx context.Context, client *vault.Client) (*vault.Secret, error)
+
+// Login implements vault.AuthMethod.
+func (f AuthFunc) Login(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+	return f(ctx, client)
+}
+
+// newAuthMethod returns the auth method configured by the provider options,
+// or nil if the Vault token from the environment is to be used.
+func newAuthMethod(opts provider.Options) (vault.AuthMethod, error) {
+	method := opts.String("auth_method")
+	mount := opts.String("auth_mount")
+	if mount == "" {
+		mount = method
+	}
+	role := opts.String("role")
+
+	switch method {
+	case "", AuthToken:
+		return nil, nil
+	case AuthKubernetes:
+		if role == "" {
+			return nil, errors.New("kubernetes auth requires the role option")
+		}
+		tokenPath := opts.String("token_path")
+		if tokenPath == "" {
+			tokenPath = DefaultKubernetesTokenPath
+		}
+		return JWTAuth(mount, role, tokenPath), nil
+	case AuthJWT:
+		if role == "" || opts.String("token_path") == "" {
+			return nil, errors.New("jwt auth requires the role and token_path options")
+		}
+		return JWTAuth(mount, role, opts.String("token_path")), nil
+	case AuthAppRole:
+		if opts.String("role_id") == "" {
+			return nil, errors.New("approle auth requires the role_id option")
+		}
+		return AppRoleAuth(mount, opts.String("role_id"), opts.String("secret_id_file")), nil
+	case AuthAWS:
+		if role == "" {
+			return nil, errors.New("aws auth requires the role option")
+		}
+		return AWSAuth(mount, role, opts.String("aws_region"), opts.String("iam_server_id")), nil
+	default:
+		return nil, fmt.Errorf("unsupported auth method %q", method)
+	}
+}
+
+func loginPath(mount string) string {
+	return "auth/" + strings.Trim(mount, "/") + "/login"
+}
+
+// JWTAuth returns an auth method logging in to the jwt or kubernetes auth
+// method mounted at mount with role, presenting the JWT read from tokenPath.
+// The token is read afresh for each login, so rotated tokens are honoured.
+func JWTAuth(mount, role, tokenPath string) AuthFunc {
+	return func(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+		jwt, err := os.ReadFile(filepath.Clean(tokenPath))
+		if err != nil {
+			return nil, fmt.Errorf("read token: %w", err)
+		}
+		return client.Logical().WriteWithContext(ctx, loginPath(mount), map[string]any{
+			"role": role,
+			"jwt":  strings.TrimSpace(string(jwt)),
+		})
+	}
+}
+
+// AppRoleAuth returns an auth method logging in to the approle auth method
+// mounted at mount with roleID and, if secretIDFile is non-empty, the secret
+// ID read from it.
+func AppRoleAuth(mount, roleID, secretIDFile string) AuthFunc {
+	return func(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+		data := map[string]any{"role_id": roleID}
+		if secretIDFile != "" {
+			secretID, err := os.ReadFile(filepath.Clean(secretIDFile))
+			if err != nil {
+				return nil, fmt.Errorf("read secret ID: %w", err)
+			}
+			data["secret_id"] = strings.TrimSpace(string(secretID))
+		}
+		return client.Logical().WriteWithContext(ctx, loginPath(mount), data)
+	}
+}
+
+// AWSAuth returns an auth method logging in to the aws auth method mounted
+// at mount with role, presenting an sts:GetCallerIdentity request signed
+// with the default AWS credentials. The request is sent to the STS endpoint
+// of region, or the global endpoint if empty, and carries the
+// X-Vault-AWS-IAM-Server-ID header if serverID is non-empty.
+func AWSAuth(mount, role, region, serverID string) AuthFunc {
+	return func(ctx context.Context, client *vault.Client) (*vault.Secret, error) {
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("load AWS configuration: %w", err)
+		}
+		credentials, err := cfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("retrieve AWS credentials: %w", err)
+		}
+
+		endpoint, signingRegion := "https://sts.amazonaws.com/", "us-east-1"
+		if region != "" {
+			endpoint, signingRegion = fmt.Sprintf("https://sts.%s.amazonaws.com/", region), region
+		}
+		body := "Action=GetCallerIdentity&Version=2011-06-15"
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		if serverID != "" {
+			req.Header.Set("X-Vault-AWS-IAM-Server-ID", serverID)
+		}
+
+		sum := sha256.Sum256([]byte(body))
+		if err := v4.NewSigner().SignHTTP(ctx, credentials, req, hex.EncodeToString(sum[:]), "sts", signingRegion, time.Now()); err != nil {
+			return nil, fmt.Errorf("sign sts:GetCallerIdentity: %w", err)
+		}
+
+		headers, err := json.Marshal(req.Header)
+		if err != nil {
+			return nil, err
+		}
+
+		return client.Logical().WriteWithContext(ctx, loginPath(mount), map[string]any{
+			"role":                    role,
+			"iam_http_request_method": http.MethodPost,
+			"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(endpoint)),
+			"iam_request_body":        base64.StdEncoding.EncodeToString([]byte(body)),
+			"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+		})
+	}
+}
+
+// authenticator logs in to Vault with an auth method and keeps the token of
+// the client renewed with a lifetime watcher, logging in again once it can
+// no longer be renewed.
+type authenticator struct {
+	client *vault.Client
+	method vault.AuthMethod
+	logger *slog.Logger
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newAuthenticator logs in within ctx and starts renewing the token in the
+// background, until Close is called.
+func newAuthenticator(ctx context.Context, client *vault.Client, method vault.AuthMethod, logger *slog.Logger) (*authenticator, error) {
+	a := &authenticator{
+		client: client,
+		method: method,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+
+	secret, err := a.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var watchCtx context.Context
+	watchCtx, a.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	go a.watch(watchCtx, secret)
+
+	return a, nil
+}
+
+// login logs in with the auth method, setting the token of the client.
+func (a *authenticator) login(ctx context.Context) (*vault.Secret, error) {
+	secret, err := a.client.Auth().Login(ctx, a.method)
+	if err != nil {
+		return nil, fmt.Errorf("vault login: %w", err)
+	}
+	if secret == nil || secret.Auth == nil {
+		return nil, errors.New("vault login: no auth information returned")
+	}
+
+	a.logger.Info("logged in to Vault", "ttl", secret.Auth.LeaseDuration, "renewable", secret.Auth.Renewable)
+	return secret, nil
+}
+
+// watch renews the token of secret until it expires, then logs in again,
+// until ctx is done.
+func (a *authenticator) watch(ctx context.Context, secret *vault.Secret) {
+	defer close(a.done)
+
+	for {
+		watcher, err := a.client.NewLifetimeWatcher(&vault.LifetimeWatcherInput{Secret: secret})
+		if err != nil {
+			a.logger.Error("failed to watch Vault token", "error", err)
+			return
+		}
+
+		go watcher.Start()
+		err = a.wait(ctx, watcher)
+		watcher.Stop()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			a.logger.Warn("Vault token renewal failed", "error", err)
+		}
+
+		for {
+			if secret, err = a.login(ctx); err == nil {
+				break
+			}
+			a.logger.Error("Vault login failed", "retry_in", reloginInterval, "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(reloginInterval):
+			}
+		}
+	}
+}
+
+// wait waits for the watcher to stop renewing, or for ctx to be done.
+func (a *authenticator) wait(ctx context.Context, watcher *vault.LifetimeWatcher) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.DoneCh():
+			return err
+		case renewal := <-watcher.RenewCh():
+			a.logger.Debug("renewed Vault token", "ttl", renewal.Secret.Auth.LeaseDuration)
+		}
+	}
+}
+
+// Close stops renewing the token.
+func (a *authenticator) Close() error {
+	a.cancel()
+	<-a.done
+	return nil
+}
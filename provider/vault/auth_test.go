@@ -0,0 +1,139 @@
+package vault_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/vault"
+	"github.com/isometry/ghait/provider/vault/vaulttest"
+)
+
+func TestVaultSigner_Auth(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("eyJ.test.jwt\n"), 0o600))
+	secretIDPath := filepath.Join(dir, "secret-id")
+	require.NoError(t, os.WriteFile(secretIDPath, []byte("s3cr3t"), 0o600))
+
+	tests := map[string]struct {
+		path    string
+		data    map[string]any
+		options provider.Options
+	}{
+		"kubernetes": {
+			path:    "auth/kubernetes/login",
+			data:    map[string]any{"role": "ghait", "jwt": "eyJ.test.jwt"},
+			options: provider.Options{"auth_method": "kubernetes", "role": "ghait", "token_path": tokenPath},
+		},
+		"jwt": {
+			path:    "auth/oidc/login",
+			data:    map[string]any{"role": "ghait", "jwt": "eyJ.test.jwt"},
+			options: provider.Options{"auth_method": "jwt", "auth_mount": "oidc", "role": "ghait", "token_path": tokenPath},
+		},
+		"approle": {
+			path:    "auth/approle/login",
+			data:    map[string]any{"role_id": "role-id", "secret_id": "s3cr3t"},
+			options: provider.Options{"auth_method": "approle", "role_id": "role-id", "secret_id_file": secretIDPath},
+		},
+		"aws": {
+			path:    "auth/aws/login",
+			data:    map[string]any{"role": "ghait", "iam_http_request_method": "POST"},
+			options: provider.Options{"auth_method": "aws", "role": "ghait"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			private, err := rsa.GenerateKey(rand.Reader, 2048)
+			require.NoError(t, err)
+
+			server := vaulttest.NewServer()
+			defer server.Close()
+			server.AddKey("transit", "github", private)
+			server.AddLogin(tt.path, vaulttest.Login{Data: tt.data, TTL: time.Hour, Renewable: true})
+
+			tt.options["address"] = server.URL
+			signer, err := provider.NewSignerWithOptions(context.Background(), "vault", "transit/sign/github", tt.options)
+			require.NoError(t, err)
+			defer signer.(io.Closer).Close()
+
+			assert.Equal(t, 1, server.LoginCount(tt.path))
+
+			_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestVaultSigner_Relogin(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := vaulttest.NewServer()
+	defer server.Close()
+	server.AddKey("transit", "github", private)
+	server.AddLogin("auth/approle/login", vaulttest.Login{TTL: 2 * time.Second})
+
+	signer, err := provider.NewSignerWithOptions(context.Background(), "vault", "transit/sign/github", provider.Options{
+		"address":     server.URL,
+		"auth_method": "approle",
+		"role_id":     "role-id",
+	})
+	require.NoError(t, err)
+	defer signer.(io.Closer).Close()
+
+	// the non-renewable token expires after 2s, prompting a fresh login
+	require.Eventually(t, func() bool {
+		return server.LoginCount("auth/approle/login") >= 2
+	}, 10*time.Second, 50*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+	require.NoError(t, err)
+}
+
+func TestVaultSigner_AuthOptions(t *testing.T) {
+	tests := map[string]provider.Options{
+		"kubernetes auth requires the role option":          {"auth_method": "kubernetes"},
+		"jwt auth requires the role and token_path options": {"auth_method": "jwt", "role": "ghait"},
+		"approle auth requires the role_id option":          {"auth_method": "approle"},
+		"aws auth requires the role option":                 {"auth_method": "aws"},
+		`invalid value "ldap"`:                              {"auth_method": "ldap"},
+	}
+
+	for expected, opts := range tests {
+		t.Run(expected, func(t *testing.T) {
+			_, err := provider.NewSignerWithOptions(context.Background(), "vault", "transit/sign/github", opts)
+			assert.ErrorContains(t, err, expected)
+		})
+	}
+}
+
+func TestVaultSigner_LoginFailure(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "")
+
+	server := vaulttest.NewServer()
+	defer server.Close()
+	server.AddLogin("auth/approle/login", vaulttest.Login{Data: map[string]any{"role_id": "expected"}, TTL: time.Hour})
+
+	_, err := vault.NewVaultSignerWithAuth(context.Background(), "transit/sign/github", nil,
+		vault.AppRoleAuth("approle", "wrong", ""), server.Config)
+	assert.ErrorContains(t, err, "invalid role_id")
+}
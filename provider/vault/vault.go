@@ -1,4 +1,4 @@
-// Package vault provides a ghinstallation.Signer implementation using HashiCorp Vault.
+// Package vault provides a signer using the HashiCorp Vault transit secrets engine.
 package vault
 
 import (
@@ -6,6 +6,8 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -16,20 +18,108 @@ import (
 )
 
 func init() {
-	provider.Register("vault", NewSigner)
+	provider.RegisterWithOptions("vault", NewSignerWithOptions, options...)
 }
 
-// vaultSigner implements provider.Provider & ghinstallation.Signer for Vault.
+// options are the provider options accepted by the Vault signer.
+var options = []provider.OptionSpec{
+	{Name: "address", Description: "Vault server address (default $VAULT_ADDR)"},
+	{Name: "namespace", Description: "Vault Enterprise namespace (default $VAULT_NAMESPACE)"},
+	{Name: "key_version", Type: provider.Int, Description: "Transit key version to sign with (default latest)"},
+	{Name: "auth_method", Description: "Auth method (default token, from $VAULT_TOKEN)", Allowed: []string{AuthToken, AuthKubernetes, AuthAppRole, AuthJWT, AuthAWS}},
+	{Name: "auth_mount", Description: "Mount path of the auth method (default auth_method)"},
+	{Name: "role", Description: "Role to log in with (kubernetes, jwt, aws)"},
+	{Name: "token_path", Description: "File holding the JWT to log in with (kubernetes, jwt)"},
+	{Name: "role_id", Description: "Role ID to log in with (approle)"},
+	{Name: "secret_id_file", Description: "File holding the secret ID to log in with (approle)"},
+	{Name: "aws_region", Description: "Region of the STS endpoint (aws, default global)"},
+	{Name: "iam_server_id", Description: "Value of the X-Vault-AWS-IAM-Server-ID header (aws)"},
+}
+
+// Logical is the subset of the Vault logical API used by the signer,
+// satisfied by the [vault.Logical] of a [vault.Client].
+type Logical interface {
+	WriteWithContext(ctx context.Context, path string, data map[string]any) (*vault.Secret, error)
+}
+
+// vaultSigner implements provider.Provider for Vault.
 type vaultSigner struct {
-	context context.Context
-	client  *vault.Client
+	logical Logical
 	key     string
+	logger  *slog.Logger
+	auth    *authenticator
+	// version pins the transit key version to sign with, if non-zero.
+	version int
+	// namespaced reports whether the namespace of the key reference, if
+	// any, is applied to requests made through logical.
+	namespaced bool
 }
 
-// NewVaultSigner creates a new Vault signer.
-func NewVaultSigner(ctx context.Context, key string, optFns ...func(*vault.Config)) (provider.Provider, error) {
+// keyReference is a parsed Vault key reference of the form
+// "[<namespace>:]<mount>/sign/<name>", or "[<namespace>:]<mount>/<name>"
+// for convenience.
+type keyReference struct {
+	namespace string
+	mount     string
+	name      string
+}
+
+// parseKeyReference parses a Vault key reference.
+func parseKeyReference(key string) (keyReference, error) {
+	var ref keyReference
+
+	path := key
+	if namespace, rest, ok := strings.Cut(key, ":"); ok {
+		ref.namespace, path = strings.Trim(namespace, "/"), rest
+		if ref.namespace == "" {
+			return ref, fmt.Errorf("invalid key reference %q: empty namespace", key)
+		}
+	}
+
+	if strings.Contains(path, "/sign/") {
+		ref.mount, ref.name = splitOnLast(path, "/sign/")
+	} else {
+		ref.mount, ref.name = splitOnLast(path, "/")
+	}
+	ref.mount = strings.Trim(ref.mount, "/")
+
+	if ref.mount == "" || ref.name == "" || strings.Contains(ref.name, "/") {
+		return ref, fmt.Errorf("invalid key reference %q: expected [<namespace>:]<mount>/sign/<name>", key)
+	}
+	return ref, nil
+}
+
+// signPath returns the transit signing path of the key.
+func (r keyReference) signPath() string {
+	return r.mount + "/sign/" + r.name
+}
+
+// NewVaultSigner creates a new Vault signer, authenticated with the Vault
+// token from the environment, logging to logger if non-nil.
+func NewVaultSigner(ctx context.Context, key string, logger *slog.Logger, optFns ...func(*vault.Config)) (provider.Provider, error) {
+	return NewVaultSignerWithAuth(ctx, key, logger, nil, optFns...)
+}
+
+// NewVaultSignerWithAuth creates a new Vault signer, logging to logger if
+// non-nil. If auth is non-nil, the signer logs in with it within ctx, and
+// keeps its token renewed in the background, logging in again once the
+// token can no longer be renewed, until the signer is closed.
+//
+// Requests, including login, are made within the namespace of the key
+// reference, if any, or else that configured by $VAULT_NAMESPACE.
+func NewVaultSignerWithAuth(ctx context.Context, key string, logger *slog.Logger, auth vault.AuthMethod, optFns ...func(*vault.Config)) (provider.Provider, error) {
+	return newVaultSigner(ctx, key, logger, auth, "", 0, optFns...)
+}
+
+func newVaultSigner(ctx context.Context, key string, logger *slog.Logger, auth vault.AuthMethod, namespace string, version int, optFns ...func(*vault.Config)) (provider.Provider, error) {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	logger = logger.With("provider", "vault", "key", key)
+
 	config := vault.DefaultConfig()
 	if err := config.ReadEnvironment(); err != nil {
+		logger.Error("failed to read Vault environment", "error", err)
 		return nil, err
 	}
 
@@ -39,39 +129,136 @@ func NewVaultSigner(ctx context.Context, key string, optFns ...func(*vault.Confi
 
 	client, err := vault.NewClient(config)
 	if err != nil {
+		logger.Error("failed to create Vault client", "error", err)
 		return nil, err
 	}
 
+	// a namespace in the key reference takes precedence; an invalid
+	// reference is reported by Check
+	if ref, err := parseKeyReference(key); err == nil && ref.namespace != "" {
+		namespace = ref.namespace
+	}
+	if namespace != "" {
+		client.SetNamespace(namespace)
+	}
+	logger.Debug("created Vault client", "address", config.Address, "namespace", client.Namespace())
+
+	signer := &vaultSigner{
+		logical:    client.Logical(),
+		key:        key,
+		logger:     logger,
+		version:    version,
+		namespaced: true,
+	}
+
+	if auth != nil {
+		if signer.auth, err = newAuthenticator(ctx, client, auth, logger); err != nil {
+			logger.Error("failed to log in to Vault", "error", err)
+			return nil, err
+		}
+	}
+
+	return signer, nil
+}
+
+// NewVaultSignerWithClient creates a new Vault signer using the logical
+// API of a pre-configured and authenticated Vault client, such as
+// client.Logical(), logging to logger if non-nil. Any namespace must be
+// configured on the client, with [vault.Client.SetNamespace], rather than
+// in the key reference.
+func NewVaultSignerWithClient(logical Logical, key string, logger *slog.Logger) provider.Provider {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
 	return &vaultSigner{
-		context: ctx,
-		client:  client,
+		logical: logical,
 		key:     key,
-	}, nil
+		logger:  logger.With("provider", "vault", "key", key),
+	}
 }
 
-// NewSigner returns a new Vault signer with default configuration.
+// NewSigner returns a new Vault signer with default configuration, logging
+// to the logger carried by ctx.
 func NewSigner(ctx context.Context, key string) (provider.Provider, error) {
-	return NewVaultSigner(ctx, key)
+	return NewSignerWithOptions(ctx, key, nil)
+}
+
+// NewSignerWithOptions returns a new Vault signer configured by the provider
+// options opts, logging to the logger carried by ctx.
+func NewSignerWithOptions(ctx context.Context, key string, opts provider.Options) (provider.Provider, error) {
+	var optFns []func(*vault.Config)
+	if address := opts.String("address"); address != "" {
+		optFns = append(optFns, func(c *vault.Config) { c.Address = address })
+	}
+
+	auth, err := newAuthMethod(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newVaultSigner(ctx, key, provider.Logger(ctx), auth, opts.String("namespace"), opts.Int("key_version"), optFns...)
 }
 
-func (s *vaultSigner) Check() error {
-	// TODO: implement appropriate checks
+// Close stops renewal of the Vault token obtained by an auth method.
+func (s *vaultSigner) Close() error {
+	if s.auth == nil {
+		return nil
+	}
+	return s.auth.Close()
+}
+
+// Check validates the key reference and the pinned key version.
+func (s *vaultSigner) Check(context.Context) error {
+	ref, err := parseKeyReference(s.key)
+	if err != nil {
+		s.logger.Error("key check failed", "error", err)
+		return err
+	}
+	if ref.namespace != "" && !s.namespaced {
+		err := fmt.Errorf("invalid key reference %q: namespace must be configured on the Vault client", s.key)
+		s.logger.Error("key check failed", "error", err)
+		return err
+	}
+	if s.version < 0 {
+		err := fmt.Errorf("invalid key version %d", s.version)
+		s.logger.Error("key check failed", "error", err)
+		return err
+	}
+
+	s.logger.Debug("key check passed", "path", ref.signPath(), "namespace", ref.namespace, "version", s.version)
 	return nil
 }
 
-// Sign signs the JWT claims with the RSA key.
-func (s *vaultSigner) Sign(claims jwt.Claims) (string, error) {
+// SignContext signs the JWT claims with the RSA key within ctx.
+func (s *vaultSigner) SignContext(ctx context.Context, claims jwt.Claims) (string, error) {
+	ref, err := parseKeyReference(s.key)
+	if err != nil {
+		s.logger.Error("transit sign failed", "error", err)
+		return "", err
+	}
+
 	method := &vaultSigningMethod{
-		context: s.context,
-		client:  s.client,
+		context: ctx,
+		logical: s.logical,
+		version: s.version,
+		logger:  s.logger,
+	}
+	signed, err := jwt.NewWithClaims(method, claims).SignedString(ref)
+	if err != nil {
+		s.logger.Error("transit sign failed", "error", err)
+		return "", err
 	}
-	return jwt.NewWithClaims(method, claims).SignedString(s.key)
+	return signed, nil
 }
 
-// vaultSigningMethod implements jwt.SigningMethod for Vault.
+// vaultSigningMethod implements jwt.SigningMethod for Vault, signing within
+// the context of a single SignContext call.
 type vaultSigningMethod struct {
 	context context.Context
-	client  *vault.Client
+	logical Logical
+	version int
+	logger  *slog.Logger
 }
 
 func (s *vaultSigningMethod) Alg() string {
@@ -79,23 +266,11 @@ func (s *vaultSigningMethod) Alg() string {
 }
 
 func (s *vaultSigningMethod) Sign(data string, ikey any) (string, error) {
-	key, ok := ikey.(string)
+	ref, ok := ikey.(keyReference)
 	if !ok {
 		return "", fmt.Errorf("invalid key reference type: %T", ikey)
 	}
 
-	// key expected in the format "<transitPath>/sign/<keyName>",
-	// but accept "<transitPath>/<keyName>" for convenience
-	signPath := key
-	if !strings.Contains(signPath, "/sign/") {
-		transitPath, keyName := splitOnLast(key, "/")
-		if keyName == "" {
-			return "", errors.New("invalid key reference format: expected transitPath/keyName")
-		}
-
-		signPath = fmt.Sprintf("%s/sign/%s", transitPath, keyName)
-	}
-
 	encodedData := base64.StdEncoding.EncodeToString([]byte(data))
 
 	input := map[string]any{
@@ -104,7 +279,10 @@ func (s *vaultSigningMethod) Sign(data string, ikey any) (string, error) {
 		"signature_algorithm":  "pkcs1v15",
 		"marshaling_algorithm": "jws",
 	}
-	resp, err := s.client.Logical().WriteWithContext(s.context, signPath, input)
+	if s.version > 0 {
+		input["key_version"] = s.version
+	}
+	resp, err := s.logical.WriteWithContext(s.context, ref.signPath(), input)
 	if err != nil {
 		return "", fmt.Errorf("failed to write to Vault: %w", err)
 	}
@@ -114,7 +292,30 @@ func (s *vaultSigningMethod) Sign(data string, ikey any) (string, error) {
 		return "", fmt.Errorf("unexpected signature type: %T", resp.Data["signature"])
 	}
 
-	return strings.TrimPrefix(vaultSignature, "vault:v1:"), nil
+	version, signature, err := parseSignature(vaultSignature)
+	if err != nil {
+		return "", err
+	}
+	if s.version > 0 && version != s.version {
+		return "", fmt.Errorf("signed with key version %d, expected %d", version, s.version)
+	}
+
+	s.logger.Debug("transit sign succeeded", "version", version)
+	return signature, nil
+}
+
+// parseSignature splits a transit signature of the form
+// "vault:v<version>:<signature>" into its key version and signature.
+func parseSignature(s string) (int, string, error) {
+	prefix, signature, ok := strings.Cut(strings.TrimPrefix(s, "vault:v"), ":")
+	if !ok || !strings.HasPrefix(s, "vault:v") {
+		return 0, "", errors.New("unexpected signature format")
+	}
+	version, err := strconv.Atoi(prefix)
+	if err != nil || version < 1 {
+		return 0, "", fmt.Errorf("unexpected signature key version %q", prefix)
+	}
+	return version, signature, nil
 }
 
 func (s *vaultSigningMethod) Verify(string, string, any) error {
@@ -0,0 +1,202 @@
+package vault_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/provider"
+	"github.com/isometry/ghait/provider/vault"
+	"github.com/isometry/ghait/provider/vault/vaulttest"
+)
+
+func TestVaultSigner(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", vaulttest.Token)
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := vaulttest.NewServer()
+	defer server.Close()
+	server.AddKey("transit", "github", private)
+
+	for _, key := range []string{"transit/sign/github", "transit/github"} {
+		t.Run(key, func(t *testing.T) {
+			signer, err := vault.NewVaultSigner(context.Background(), key, nil, server.Config)
+			require.NoError(t, err)
+			require.NoError(t, signer.Check(context.Background()))
+
+			claims := &jwt.RegisteredClaims{
+				Issuer:    "12345",
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			}
+			signed, err := signer.SignContext(context.Background(), claims)
+			require.NoError(t, err)
+
+			parsed, err := jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, func(*jwt.Token) (any, error) {
+				return &private.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+			assert.Equal(t, "12345", parsed.Claims.(*jwt.RegisteredClaims).Issuer)
+		})
+	}
+}
+
+func TestVaultSigner_UnknownKey(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", vaulttest.Token)
+
+	server := vaulttest.NewServer()
+	defer server.Close()
+
+	signer, err := vault.NewVaultSigner(context.Background(), "transit/missing", nil, server.Config)
+	require.NoError(t, err)
+
+	_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+	assert.ErrorContains(t, err, "encryption key not found")
+}
+
+func TestNewVaultSignerWithClient(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := vaulttest.NewServer()
+	defer server.Close()
+	server.AddKey("transit", "github", private)
+
+	config := vaultapi.DefaultConfig()
+	server.Config(config)
+	client, err := vaultapi.NewClient(config)
+	require.NoError(t, err)
+	client.SetToken(vaulttest.Token)
+
+	signer := vault.NewVaultSignerWithClient(client.Logical(), "transit/sign/github", nil)
+
+	signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+	require.NoError(t, err)
+
+	_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+		return &private.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}))
+	require.NoError(t, err)
+}
+
+func TestVaultSigner_KeyVersion(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", vaulttest.Token)
+
+	v1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	v2, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := vaulttest.NewServer()
+	defer server.Close()
+	server.AddKey("transit", "github", v1)
+	server.AddKey("transit", "github", v2)
+
+	tests := map[string]struct {
+		options provider.Options
+		public  *rsa.PublicKey
+	}{
+		"latest": {options: provider.Options{}, public: &v2.PublicKey},
+		"pinned": {options: provider.Options{"key_version": "1"}, public: &v1.PublicKey},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.options["address"] = server.URL
+			signer, err := provider.NewSignerWithOptions(context.Background(), "vault", "transit/sign/github", tt.options)
+			require.NoError(t, err)
+			require.NoError(t, signer.Check(context.Background()))
+
+			signed, err := signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+
+			_, err = jwt.Parse(signed, func(*jwt.Token) (any, error) {
+				return tt.public, nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		signer, err := provider.NewSignerWithOptions(context.Background(), "vault", "transit/sign/github", provider.Options{
+			"address":     server.URL,
+			"key_version": "3",
+		})
+		require.NoError(t, err)
+
+		_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		assert.ErrorContains(t, err, "requested version for signing does not exist")
+	})
+}
+
+func TestVaultSigner_Namespace(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", vaulttest.Token)
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := vaulttest.NewServer()
+	defer server.Close()
+	server.AddNamespacedKey("admin/team", "transit", "github", private)
+
+	tests := map[string]struct {
+		key     string
+		options provider.Options
+	}{
+		"key reference": {key: "admin/team:transit/sign/github", options: provider.Options{}},
+		"option":        {key: "transit/sign/github", options: provider.Options{"namespace": "admin/team"}},
+		"precedence":    {key: "admin/team:transit/github", options: provider.Options{"namespace": "other"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.options["address"] = server.URL
+			signer, err := provider.NewSignerWithOptions(context.Background(), "vault", tt.key, tt.options)
+			require.NoError(t, err)
+			require.NoError(t, signer.Check(context.Background()))
+
+			_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("outside namespace", func(t *testing.T) {
+		signer, err := vault.NewVaultSigner(context.Background(), "transit/sign/github", nil, server.Config)
+		require.NoError(t, err)
+
+		_, err = signer.SignContext(context.Background(), &jwt.RegisteredClaims{Issuer: "12345"})
+		assert.ErrorContains(t, err, "encryption key not found")
+	})
+}
+
+func TestVaultSigner_Check(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", vaulttest.Token)
+
+	server := vaulttest.NewServer()
+	defer server.Close()
+
+	for _, key := range []string{"github", "transit/sign/", "/sign/github", "transit/sign/team/github", ":transit/sign/github"} {
+		t.Run(key, func(t *testing.T) {
+			signer, err := vault.NewVaultSigner(context.Background(), key, nil, server.Config)
+			require.NoError(t, err)
+			assert.ErrorContains(t, signer.Check(context.Background()), "invalid key reference")
+		})
+	}
+
+	t.Run("namespace with client", func(t *testing.T) {
+		client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+		require.NoError(t, err)
+
+		signer := vault.NewVaultSignerWithClient(client.Logical(), "admin:transit/sign/github", nil)
+		assert.ErrorContains(t, signer.Check(context.Background()), "namespace must be configured on the Vault client")
+	})
+}
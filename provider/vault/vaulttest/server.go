@@ -0,0 +1,346 @@
+// Package vaulttest provides a fake Vault transit secrets engine server for
+// testing the vault provider without a Vault deployment.
+package vaulttest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// Token is a non-expiring Vault token accepted by the server.
+const Token = "test-token"
+
+// Server is a fake Vault server implementing the sign and key read
+// endpoints of the transit secrets engine for RSA keys, together with
+// auth method logins and token renewal.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	keys   map[string]*key
+	logins map[string]*login
+	tokens map[string]*token
+}
+
+// Login configures an auth method login endpoint of the server.
+type Login struct {
+	// Data holds the values that must be present in the login request.
+	Data map[string]any
+	// TTL is the lifetime of issued tokens.
+	TTL time.Duration
+	// Renewable marks issued tokens as renewable, each renewal extending
+	// their lifetime by TTL.
+	Renewable bool
+}
+
+type login struct {
+	Login
+	count int
+}
+
+type token struct {
+	expires   time.Time
+	ttl       time.Duration
+	renewable bool
+}
+
+// key is a transit key, with one RSA key per version.
+type key struct {
+	versions []*rsa.PrivateKey
+}
+
+// NewServer starts and returns a new Server. The caller should call Close
+// when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		keys:   map[string]*key{},
+		logins: map[string]*login{},
+		tokens: map[string]*token{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddKey registers an RSA key as a new version of the transit key name,
+// mounted at mount, returning the key version.
+func (s *Server) AddKey(mount, name string, private *rsa.PrivateKey) int {
+	return s.AddNamespacedKey("", mount, name, private)
+}
+
+// AddNamespacedKey registers an RSA key as a new version of the transit key
+// name, mounted at mount within the Vault Enterprise namespace, returning
+// the key version.
+func (s *Server) AddNamespacedKey(namespace, mount, name string, private *rsa.PrivateKey) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := keyID(namespace, mount, name)
+	k, ok := s.keys[id]
+	if !ok {
+		k = &key{}
+		s.keys[id] = k
+	}
+	k.versions = append(k.versions, private)
+	return len(k.versions)
+}
+
+// AddLogin enables login at path, for example "auth/kubernetes/login",
+// issuing tokens as configured by l to requests carrying l.Data.
+func (s *Server) AddLogin(path string, l Login) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logins[strings.Trim(path, "/")] = &login{Login: l}
+}
+
+// LoginCount returns the number of successful logins at path.
+func (s *Server) LoginCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l, ok := s.logins[strings.Trim(path, "/")]; ok {
+		return l.count
+	}
+	return 0
+}
+
+// Config configures a Vault client to use the server.
+func (s *Server) Config(config *vault.Config) {
+	config.Address = s.URL
+	config.MaxRetries = 0
+}
+
+func keyID(namespace, mount, name string) string {
+	return strings.Trim(namespace, "/") + "|" + strings.Trim(mount, "/") + "|" + name
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	s.mu.Lock()
+	l, isLogin := s.logins[p]
+	s.mu.Unlock()
+
+	if isLogin && (r.Method == http.MethodPut || r.Method == http.MethodPost) {
+		s.login(w, r, l)
+		return
+	}
+
+	tokenID := r.Header.Get("X-Vault-Token")
+	if !s.valid(tokenID) {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	namespace := r.Header.Get("X-Vault-Namespace")
+
+	switch {
+	case (r.Method == http.MethodPut || r.Method == http.MethodPost) && p == "auth/token/renew-self":
+		s.renewSelf(w, tokenID)
+	case (r.Method == http.MethodPut || r.Method == http.MethodPost) && strings.Contains(p, "/sign/"):
+		mount, name := splitOnLast(p, "/sign/")
+		s.sign(w, r, namespace, mount, name)
+	case r.Method == http.MethodGet && strings.Contains(p, "/keys/"):
+		mount, name := splitOnLast(p, "/keys/")
+		s.readKey(w, namespace, mount, name)
+	default:
+		writeErrors(w, http.StatusNotFound, fmt.Sprintf("no handler for route %q", p))
+	}
+}
+
+// valid reports whether id is an unexpired token issued by the server.
+func (s *Server) valid(id string) bool {
+	if id == Token {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	return ok && time.Now().Before(t.expires)
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request, l *login) {
+	var data map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for name, value := range l.Data {
+		if data[name] != value {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid %s", name))
+			return
+		}
+	}
+
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	id := "hvs." + hex.EncodeToString(b)
+
+	s.mu.Lock()
+	l.count++
+	s.tokens[id] = &token{expires: time.Now().Add(l.TTL), ttl: l.TTL, renewable: l.Renewable}
+	s.mu.Unlock()
+
+	writeAuth(w, id, l.TTL, l.Renewable)
+}
+
+func (s *Server) renewSelf(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	t, ok := s.tokens[id]
+	if ok && t.renewable {
+		t.expires = time.Now().Add(t.ttl)
+	}
+	s.mu.Unlock()
+
+	if !ok || !t.renewable {
+		writeErrors(w, http.StatusBadRequest, "lease is not renewable")
+		return
+	}
+	writeAuth(w, id, t.ttl, true)
+}
+
+func (s *Server) lookup(w http.ResponseWriter, namespace, mount, name string) (*key, bool) {
+	s.mu.Lock()
+	k, ok := s.keys[keyID(namespace, mount, name)]
+	s.mu.Unlock()
+
+	if !ok {
+		writeErrors(w, http.StatusBadRequest, "encryption key not found")
+	}
+	return k, ok
+}
+
+func (s *Server) sign(w http.ResponseWriter, r *http.Request, namespace, mount, name string) {
+	k, ok := s.lookup(w, namespace, mount, name)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Input               string `json:"input"`
+		KeyVersion          int    `json:"key_version"`
+		HashAlgorithm       string `json:"hash_algorithm"`
+		SignatureAlgorithm  string `json:"signature_algorithm"`
+		MarshalingAlgorithm string `json:"marshaling_algorithm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if input.HashAlgorithm != "sha2-256" || input.SignatureAlgorithm != "pkcs1v15" {
+		writeErrors(w, http.StatusBadRequest, "unsupported hash or signature algorithm")
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(input.Input)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "unable to decode input as base64")
+		return
+	}
+
+	version := input.KeyVersion
+	if version == 0 {
+		version = len(k.versions)
+	}
+	if version < 1 || version > len(k.versions) {
+		writeErrors(w, http.StatusBadRequest, "requested version for signing does not exist")
+		return
+	}
+
+	digest := sha256.Sum256(data)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.versions[version-1], crypto.SHA256, digest[:])
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(signature)
+	if input.MarshalingAlgorithm == "jws" {
+		encoded = base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	writeData(w, map[string]any{
+		"signature":   fmt.Sprintf("vault:v%d:%s", version, encoded),
+		"key_version": version,
+	})
+}
+
+func (s *Server) readKey(w http.ResponseWriter, namespace, mount, name string) {
+	k, ok := s.lookup(w, namespace, mount, name)
+	if !ok {
+		return
+	}
+
+	versions := map[string]any{}
+	for i, private := range k.versions {
+		der, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		versions[strconv.Itoa(i+1)] = map[string]any{
+			"name":       "rsa-" + strconv.Itoa(private.N.BitLen()),
+			"public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		}
+	}
+
+	writeData(w, map[string]any{
+		"name":                   name,
+		"type":                   "rsa-" + strconv.Itoa(k.versions[0].N.BitLen()),
+		"keys":                   versions,
+		"latest_version":         len(k.versions),
+		"min_available_version":  0,
+		"min_decryption_version": 1,
+		"supports_signing":       true,
+		"supports_encryption":    true,
+	})
+}
+
+func splitOnLast(s, sep string) (string, string) {
+	index := strings.LastIndex(s, sep)
+	if index == -1 {
+		return s, ""
+	}
+	return s[:index], s[index+len(sep):]
+}
+
+func writeData(w http.ResponseWriter, data map[string]any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func writeAuth(w http.ResponseWriter, id string, ttl time.Duration, renewable bool) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"auth": map[string]any{
+			"client_token":   id,
+			"lease_duration": int(ttl.Seconds()),
+			"renewable":      renewable,
+		},
+	})
+}
+
+func writeErrors(w http.ResponseWriter, status int, errors ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"errors": errors})
+}
@@ -0,0 +1,127 @@
+package ghait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+)
+
+// RateLimitBehavior determines how token requests are handled when the
+// GitHub primary rate limit remaining drops to the configured threshold.
+type RateLimitBehavior int
+
+const (
+	// RateLimitIgnore sends all requests regardless of the rate limit.
+	RateLimitIgnore RateLimitBehavior = iota
+	// RateLimitBlock delays requests until the rate limit resets.
+	RateLimitBlock
+	// RateLimitFailFast rejects requests with a RateLimitError.
+	RateLimitFailFast
+	// RateLimitShed rejects low-priority requests with a RateLimitError,
+	// reserving the remaining quota for other requests.
+	RateLimitShed
+)
+
+// RateLimitPolicy configures pre-emptive throttling of token requests.
+type RateLimitPolicy struct {
+	// Threshold is the number of remaining requests at or below which
+	// Behavior applies.
+	Threshold int
+	// Behavior determines how requests are handled at or below Threshold.
+	Behavior RateLimitBehavior
+}
+
+// RateLimitError is returned when a token request is rejected to preserve
+// the GitHub rate limit. It is classified as a TransientError.
+type RateLimitError struct {
+	Remaining int
+	Reset     time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit remaining %d at or below threshold, resets at %s", e.Remaining, e.Reset.Format(time.RFC3339))
+}
+
+// Priority is the priority of a token request, used when throttling.
+// Higher priorities compare greater.
+type Priority int
+
+const (
+	// PriorityLow requests are the first to be shed.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the priority of requests carrying none.
+	PriorityNormal
+	// PriorityHigh requests may use the headroom reserved by the threshold
+	// under any behavior, until the rate limit is exhausted.
+	PriorityHigh
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx carrying the priority of token requests
+// made with it.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFromContext returns the request priority carried by ctx, or
+// PriorityNormal if none.
+func PriorityFromContext(ctx context.Context) Priority {
+	priority, _ := ctx.Value(priorityKey{}).(Priority)
+	return priority
+}
+
+// RateLimit returns the GitHub primary rate limit state, as last observed
+// in a response to the ghait instance.
+func (g *ghait) RateLimit() github.Rate {
+	return g.Stats().RateLimit
+}
+
+// throttle applies the configured rate limit policy to a token request,
+// blocking or returning a RateLimitError as appropriate.
+func (g *ghait) throttle(ctx context.Context) error {
+	rp := g.rateLimitPolicy
+	if rp.Behavior == RateLimitIgnore {
+		return nil
+	}
+
+	rate := g.RateLimit()
+	reset := rate.Reset.Time
+	if rate.Limit == 0 || rate.Remaining > rp.Threshold || !time.Now().Before(reset) {
+		// unknown, above threshold or already reset
+		return nil
+	}
+
+	priority := PriorityFromContext(ctx)
+	if priority >= PriorityHigh && rate.Remaining > 0 {
+		// high-priority requests use the reserved headroom
+		return nil
+	}
+
+	limitErr := &RateLimitError{Remaining: rate.Remaining, Reset: reset}
+
+	switch rp.Behavior {
+	case RateLimitShed:
+		if priority > PriorityLow && rate.Remaining > 0 {
+			return nil
+		}
+		return errors.Join(TransientError{}, limitErr)
+	case RateLimitFailFast:
+		return errors.Join(TransientError{}, limitErr)
+	case RateLimitBlock:
+		g.logger.Warn("rate limit threshold reached, waiting for reset", "remaining", rate.Remaining, "reset", reset)
+		timer := time.NewTimer(time.Until(reset))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return errors.Join(TransientError{}, limitErr, ctx.Err())
+		case <-timer.C:
+			return nil
+		}
+	default:
+		return nil
+	}
+}
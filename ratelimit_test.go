@@ -0,0 +1,134 @@
+package ghait_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait"
+)
+
+func TestRateLimitPolicy(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server, p := newTestServer(t)
+	server.SetRateLimit(github.Rate{Limit: 5000, Remaining: 3, Reset: github.Timestamp{Time: reset}})
+
+	tests := map[ghait.RateLimitBehavior]struct {
+		normal bool
+		low    bool
+	}{
+		ghait.RateLimitIgnore:   {normal: true, low: true},
+		ghait.RateLimitFailFast: {normal: false, low: false},
+		ghait.RateLimitShed:     {normal: true, low: false},
+	}
+
+	for behavior, expected := range tests {
+		t.Run(strconv.Itoa(int(behavior)), func(t *testing.T) {
+			ctx := context.Background()
+			factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+				ghait.WithBaseURL(server.BaseURL()),
+				ghait.WithSigner(p),
+				ghait.WithRateLimitPolicy(ghait.RateLimitPolicy{Threshold: 10, Behavior: behavior}),
+			)
+			require.NoError(t, err)
+
+			// the first request observes the rate limit
+			_, err = factory.NewToken(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 3, factory.RateLimit().Remaining)
+
+			// high-priority requests use the headroom
+			_, err = factory.NewToken(ghait.WithPriority(ctx, ghait.PriorityHigh))
+			require.NoError(t, err)
+
+			_, err = factory.NewToken(ctx)
+			assertThrottled(t, !expected.normal, err, reset)
+
+			_, err = factory.NewToken(ghait.WithPriority(ctx, ghait.PriorityLow))
+			assertThrottled(t, !expected.low, err, reset)
+
+			// as are listing tokens
+			_, err = factory.ResolveRepositories(ctx, 0, []ghait.RepositorySelector{{Pattern: "service-*"}})
+			assertThrottled(t, !expected.normal, err, reset)
+		})
+	}
+}
+
+func TestRateLimitPolicy_Block(t *testing.T) {
+	// the reset header has a resolution of one second
+	reset := time.Now().Add(1500 * time.Millisecond).Truncate(time.Second).Add(time.Second)
+	server, p := newTestServer(t)
+	server.SetRateLimit(github.Rate{Limit: 5000, Remaining: 3, Reset: github.Timestamp{Time: reset}})
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithSigner(p),
+		ghait.WithRateLimitPolicy(ghait.RateLimitPolicy{Threshold: 10, Behavior: ghait.RateLimitBlock}),
+	)
+	require.NoError(t, err)
+
+	_, err = factory.NewToken(ctx)
+	require.NoError(t, err)
+
+	// high-priority requests do not wait
+	_, err = factory.NewToken(ghait.WithPriority(ctx, ghait.PriorityHigh))
+	require.NoError(t, err)
+
+	// others wait for the reset, unless the context is done first
+	shortCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = factory.NewToken(shortCtx)
+	assertThrottled(t, true, err, reset)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = factory.NewToken(ctx)
+	require.NoError(t, err)
+	assert.False(t, time.Now().Before(reset))
+	assert.Len(t, server.Tokens(), 3)
+}
+
+func TestRateLimit_EveryResponse(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server, p := newTestServer(t)
+
+	ctx := context.Background()
+	factory, err := ghait.NewGHAIT(ctx, ghait.NewConfig(12345, 67890, "", ""),
+		ghait.WithBaseURL(server.BaseURL()),
+		ghait.WithSigner(p),
+	)
+	require.NoError(t, err)
+
+	server.SetRateLimit(github.Rate{Limit: 5000, Remaining: 42, Reset: github.Timestamp{Time: reset}})
+	_, _, err = factory.ListInstallations(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 42, factory.RateLimit().Remaining)
+	assert.True(t, reset.Equal(factory.RateLimit().Reset.Time))
+
+	// failed requests report the rate limit too
+	server.SetRateLimit(github.Rate{Limit: 5000, Remaining: 41, Reset: github.Timestamp{Time: reset}})
+	server.FailNext("POST", "/app/installations/*/access_tokens", 403, 1)
+	_, err = factory.NewToken(ctx)
+	require.Error(t, err)
+	assert.Equal(t, 41, factory.RateLimit().Remaining)
+}
+
+func assertThrottled(t *testing.T, throttled bool, err error, reset time.Time) {
+	t.Helper()
+	if !throttled {
+		assert.NoError(t, err)
+		return
+	}
+
+	var limitErr *ghait.RateLimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, 3, limitErr.Remaining)
+	assert.True(t, reset.Equal(limitErr.Reset))
+	assert.True(t, errors.Is(err, ghait.TransientError{}))
+}
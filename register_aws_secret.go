@@ -0,0 +1,8 @@
+//go:build !no_aws_secret
+
+package ghait
+
+import (
+	// Register the AWS Secrets Manager provider.
+	_ "github.com/isometry/ghait/provider/awssecret"
+)
@@ -0,0 +1,8 @@
+//go:build !no_env
+
+package ghait
+
+import (
+	// Register the environment variable provider.
+	_ "github.com/isometry/ghait/provider/env"
+)
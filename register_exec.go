@@ -0,0 +1,8 @@
+//go:build !no_exec
+
+package ghait
+
+import (
+	// Register the command output provider.
+	_ "github.com/isometry/ghait/provider/exec"
+)
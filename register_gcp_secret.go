@@ -0,0 +1,8 @@
+//go:build !no_gcp_secret
+
+package ghait
+
+import (
+	// Register the GCP Secret Manager provider.
+	_ "github.com/isometry/ghait/provider/gcpsecret"
+)
@@ -0,0 +1,8 @@
+//go:build !no_op
+
+package ghait
+
+import (
+	// Register the 1Password provider.
+	_ "github.com/isometry/ghait/provider/onepassword"
+)
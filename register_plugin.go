@@ -0,0 +1,8 @@
+//go:build !no_plugin
+
+package ghait
+
+import (
+	// Register the plugin providers discovered on $PATH.
+	_ "github.com/isometry/ghait/provider/plugin"
+)
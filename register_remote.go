@@ -0,0 +1,8 @@
+//go:build !no_remote
+
+package ghait
+
+import (
+	// Register the remote signing server provider.
+	_ "github.com/isometry/ghait/provider/remote"
+)
@@ -0,0 +1,219 @@
+package ghait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofri/go-github-ratelimit/v2/github_ratelimit"
+	"github.com/google/go-github/v80/github"
+)
+
+// purposeListing is the purpose of the tokens listing the repositories
+// accessible to an installation.
+const purposeListing = "repository-listing"
+
+// MaxRepositories is the maximum number of repositories to which GitHub
+// permits a single installation token to be restricted.
+const MaxRepositories = 500
+
+// TooManyRepositoriesError is returned when a repository selection exceeds
+// MaxRepositories.
+type TooManyRepositoriesError struct {
+	Count int
+}
+
+func (e *TooManyRepositoriesError) Error() string {
+	return fmt.Sprintf("%d repositories selected, exceeding GitHub's limit of %d per token", e.Count, MaxRepositories)
+}
+
+// RepositorySelector selects repositories accessible to an installation.
+// Exactly one field is set.
+type RepositorySelector struct {
+	// Name selects a repository by exact name.
+	Name string
+	// Pattern selects repositories whose names match a glob pattern.
+	Pattern string
+	// Topic selects repositories with the given topic.
+	Topic string
+	// ID selects a repository by ID.
+	ID int64
+}
+
+// ParseRepositorySelector parses a repository selector of the form
+// "name", "glob*", "topic:<topic>" or "id:<id>".
+func ParseRepositorySelector(s string) (RepositorySelector, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return RepositorySelector{}, errors.New("empty repository selector")
+	case strings.HasPrefix(s, "topic:"):
+		topic := strings.TrimPrefix(s, "topic:")
+		if topic == "" {
+			return RepositorySelector{}, fmt.Errorf("invalid repository selector %q: empty topic", s)
+		}
+		return RepositorySelector{Topic: topic}, nil
+	case strings.HasPrefix(s, "id:"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(s, "id:"), 10, 64)
+		if err != nil || id <= 0 {
+			return RepositorySelector{}, fmt.Errorf("invalid repository selector %q: invalid ID", s)
+		}
+		return RepositorySelector{ID: id}, nil
+	case strings.ContainsAny(s, `*?[\`):
+		if _, err := path.Match(s, ""); err != nil {
+			return RepositorySelector{}, fmt.Errorf("invalid repository selector %q: %w", s, err)
+		}
+		return RepositorySelector{Pattern: s}, nil
+	default:
+		return RepositorySelector{Name: s}, nil
+	}
+}
+
+// ParseRepositorySelectors parses each of the given repository selectors.
+func ParseRepositorySelectors(ss []string) ([]RepositorySelector, error) {
+	selectors := make([]RepositorySelector, 0, len(ss))
+	for _, s := range ss {
+		selector, err := ParseRepositorySelector(s)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	return selectors, nil
+}
+
+func (s RepositorySelector) needsListing() bool {
+	return s.Pattern != "" || s.Topic != ""
+}
+
+func (s RepositorySelector) matches(repo *github.Repository) bool {
+	switch {
+	case s.Name != "":
+		return repo.GetName() == s.Name
+	case s.Pattern != "":
+		ok, _ := path.Match(s.Pattern, repo.GetName())
+		return ok
+	case s.Topic != "":
+		return slices.Contains(repo.Topics, s.Topic)
+	case s.ID != 0:
+		return repo.GetID() == s.ID
+	default:
+		return false
+	}
+}
+
+// ResolveRepositories expands the given selectors into token options
+// restricting access to the selected repositories of the specified
+// installation, or of the configured installation if zero.
+// Exact names and IDs are passed through as-is; if any glob or topic
+// selector is present, the repositories accessible to the installation are
+// listed using a short-lived metadata-only token, which is revoked after use.
+// The listing token is throttled and audited like any other token, but not
+// evaluated against the policy, which applies to the token requested with
+// the resolved options.
+// An error is returned if no repository matches, if an exact name or ID
+// matches no accessible repository, or if the selection exceeds
+// MaxRepositories.
+func (g *ghait) ResolveRepositories(ctx context.Context, installationID int64, selectors []RepositorySelector) (*github.InstallationTokenOptions, error) {
+	options := &github.InstallationTokenOptions{}
+	if len(selectors) == 0 {
+		return options, nil
+	}
+
+	if !slices.ContainsFunc(selectors, RepositorySelector.needsListing) {
+		for _, s := range selectors {
+			if s.ID != 0 {
+				options.RepositoryIDs = appendUnique(options.RepositoryIDs, s.ID)
+			} else {
+				options.Repositories = appendUnique(options.Repositories, s.Name)
+			}
+		}
+		if err := checkRepositoryCount(len(options.Repositories) + len(options.RepositoryIDs)); err != nil {
+			return nil, err
+		}
+		return options, nil
+	}
+
+	repos, err := g.listRepositories(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repo := range repos {
+		if slices.ContainsFunc(selectors, func(s RepositorySelector) bool { return s.matches(repo) }) {
+			options.Repositories = appendUnique(options.Repositories, repo.GetName())
+		}
+	}
+
+	if len(options.Repositories) == 0 {
+		return nil, errors.New("no accessible repository matches the repository selectors")
+	}
+
+	var unmatched []string
+	for _, s := range selectors {
+		if s.needsListing() || slices.ContainsFunc(repos, s.matches) {
+			continue
+		}
+		if s.ID != 0 {
+			unmatched = append(unmatched, "id:"+strconv.FormatInt(s.ID, 10))
+		} else {
+			unmatched = append(unmatched, s.Name)
+		}
+	}
+	if len(unmatched) > 0 {
+		return nil, fmt.Errorf("no accessible repository matches %s", strings.Join(unmatched, ", "))
+	}
+
+	if err := checkRepositoryCount(len(options.Repositories)); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// listRepositories lists all repositories accessible to the installation.
+func (g *ghait) listRepositories(ctx context.Context, installationID int64) ([]*github.Repository, error) {
+	token, err := g.newInstallationToken(ctx, installationID, &github.InstallationTokenOptions{
+		Permissions: &github.InstallationPermissions{Metadata: github.Ptr("read")},
+	}, purposeListing)
+	if err != nil {
+		return nil, fmt.Errorf("listing token: %w", err)
+	}
+
+	client := github.NewClient(github_ratelimit.NewClient(g.transport)).WithAuthToken(token.GetToken())
+	client.BaseURL = g.Client.BaseURL
+	defer func() {
+		_, _ = client.Apps.RevokeInstallationToken(context.WithoutCancel(ctx))
+	}()
+
+	var repos []*github.Repository
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		list, resp, err := client.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("list repositories: %w", wrapTokenResponseError(resp, err))
+		}
+		repos = append(repos, list.Repositories...)
+		if resp.NextPage == 0 {
+			return repos, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func checkRepositoryCount(n int) error {
+	if n > MaxRepositories {
+		return errors.Join(FatalError{}, &TooManyRepositoriesError{Count: n})
+	}
+	return nil
+}
+
+func appendUnique[T comparable](s []T, v T) []T {
+	if slices.Contains(s, v) {
+		return s
+	}
+	return append(s, v)
+}
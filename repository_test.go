@@ -0,0 +1,37 @@
+package ghait_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait"
+)
+
+func TestParseRepositorySelector(t *testing.T) {
+	tests := map[string]ghait.RepositorySelector{
+		"repo":                {Name: "repo"},
+		" service-* ":         {Pattern: "service-*"},
+		"app-[ab]":            {Pattern: "app-[ab]"},
+		"topic:deploy-target": {Topic: "deploy-target"},
+		"id:12345":            {ID: 12345},
+	}
+
+	for input, expected := range tests {
+		t.Run(input, func(t *testing.T) {
+			selector, err := ghait.ParseRepositorySelector(input)
+			require.NoError(t, err)
+			assert.Equal(t, expected, selector)
+		})
+	}
+}
+
+func TestParseRepositorySelector_Invalid(t *testing.T) {
+	for _, input := range []string{"", "topic:", "id:", "id:abc", "id:-1", "app-["} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ghait.ParseRepositorySelector(input)
+			assert.Error(t, err)
+		})
+	}
+}
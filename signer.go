@@ -0,0 +1,64 @@
+package ghait
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/isometry/ghait/provider"
+)
+
+// instrumentedSigner wraps a provider.Provider, logging, tracing and
+// measuring each signing operation.
+type instrumentedSigner struct {
+	provider.Provider
+	name      string
+	logger    *slog.Logger
+	telemetry *telemetry
+	stats     *stats
+}
+
+func newInstrumentedSigner(p provider.Provider, name string, logger *slog.Logger, telemetry *telemetry, stats *stats) *instrumentedSigner {
+	return &instrumentedSigner{
+		Provider:  p,
+		name:      name,
+		logger:    logger,
+		telemetry: telemetry,
+		stats:     stats,
+	}
+}
+
+// sign signs the JWT claims with the wrapped provider, within a span
+// descending from ctx.
+func (s *instrumentedSigner) sign(ctx context.Context, claims jwt.Claims) (string, error) {
+	providerAttr := attribute.String("ghait.provider", s.name)
+
+	ctx, span := s.telemetry.tracer.Start(ctx, "ghait.Sign",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(providerAttr),
+	)
+	defer span.End()
+
+	start := time.Now()
+	signed, err := s.Provider.SignContext(ctx, claims)
+	latency := time.Since(start)
+
+	s.telemetry.signDuration.Record(ctx, latency.Seconds(), metric.WithAttributes(providerAttr))
+	s.stats.recordSign(latency)
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "sign failed")
+		s.logger.Error("sign failed", "provider", s.name, "latency", latency, "error", err)
+		return "", err
+	}
+
+	s.logger.Debug("signed app token", "provider", s.name, "latency", latency)
+	return signed, nil
+}
@@ -0,0 +1,318 @@
+// Package signer provides a signing server exposing a provider.Provider over
+// mutual TLS, so that many hosts may mint GitHub App tokens with a private
+// key held by one. The server signs nothing but GitHub App JWTs, for allowed
+// app IDs, with bounded lifetimes.
+package signer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/isometry/ghait/provider"
+)
+
+// Paths of the signing server endpoints.
+const (
+	// SignPath accepts a POSTed SignRequest, answered by a SignResponse.
+	SignPath = "/v1/sign"
+	// CheckPath answers a GET with a CheckResponse, once the client is
+	// authorized.
+	CheckPath = "/v1/check"
+)
+
+const (
+	// DefaultMaxLifetime is the default maximum lifetime of a signed JWT,
+	// the maximum accepted by GitHub.
+	DefaultMaxLifetime = 10 * time.Minute
+	// DefaultClockSkew is the default tolerance of the issue time of a
+	// signed JWT, either side of the server clock.
+	DefaultClockSkew = 2 * time.Minute
+)
+
+// Claims are the claims of a GitHub App JWT, the only claims the server
+// will sign.
+type Claims struct {
+	// Issuer is the app ID.
+	Issuer string `json:"iss"`
+	// IssuedAt is the issue time, in seconds since the Unix epoch.
+	IssuedAt int64 `json:"iat"`
+	// ExpiresAt is the expiry time, in seconds since the Unix epoch.
+	ExpiresAt int64 `json:"exp"`
+}
+
+// SignRequest is a request to sign claims.
+type SignRequest struct {
+	Claims Claims `json:"claims"`
+}
+
+// SignResponse is the response to a SignRequest.
+type SignResponse struct {
+	// Token is the signed JWT.
+	Token string `json:"token"`
+}
+
+// CheckResponse is the response to a check.
+type CheckResponse struct {
+	// AppIDs are the app IDs for which the server signs.
+	AppIDs []int64 `json:"app_ids"`
+}
+
+// ErrorResponse is the response to a failed request.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Config configures the authorization of the signing server.
+type Config struct {
+	// AppIDs are the app IDs for which the server signs; required.
+	AppIDs []int64
+	// Clients are the identities of the authorized clients, matched against
+	// the common name and DNS and URI subject alternative names of their
+	// certificates; required unless AllowAnyClient.
+	Clients []string
+	// AllowAnyClient authorizes any client presenting a certificate
+	// verified against the client CAs, in place of Clients.
+	AllowAnyClient bool
+	// MaxLifetime is the maximum lifetime of a signed JWT, defaulting to
+	// DefaultMaxLifetime.
+	MaxLifetime time.Duration
+	// ClockSkew is the tolerance of the issue time of a signed JWT,
+	// defaulting to DefaultClockSkew.
+	ClockSkew time.Duration
+}
+
+// Handler serves signing requests from authorized clients with a provider.
+type Handler struct {
+	provider provider.Provider
+	config   Config
+	logger   *slog.Logger
+	mux      *http.ServeMux
+}
+
+// NewHandler returns a Handler signing with p, as authorized by cfg,
+// logging to logger if non-nil. The handler must be served over TLS,
+// verifying client certificates, such as configured by ServerTLSConfig.
+func NewHandler(p provider.Provider, cfg Config, logger *slog.Logger) (*Handler, error) {
+	if len(cfg.AppIDs) == 0 {
+		return nil, errors.New("at least one allowed app ID is required")
+	}
+	switch {
+	case len(cfg.Clients) == 0 && !cfg.AllowAnyClient:
+		return nil, errors.New("at least one allowed client is required, unless any client is allowed")
+	case len(cfg.Clients) > 0 && cfg.AllowAnyClient:
+		return nil, errors.New("allowed clients cannot be given when any client is allowed")
+	}
+	if cfg.MaxLifetime <= 0 {
+		cfg.MaxLifetime = DefaultMaxLifetime
+	}
+	if cfg.ClockSkew <= 0 {
+		cfg.ClockSkew = DefaultClockSkew
+	}
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	h := &Handler{
+		provider: p,
+		config:   cfg,
+		logger:   logger,
+		mux:      http.NewServeMux(),
+	}
+	h.mux.HandleFunc("POST "+SignPath, h.sign)
+	h.mux.HandleFunc("GET "+CheckPath, h.check)
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler, rejecting unauthorized clients.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client, err := h.authorize(r)
+	if err != nil {
+		h.logger.Warn("rejected client", "remote", r.RemoteAddr, "client", client, "error", err)
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	h.mux.ServeHTTP(w, r.WithContext(withClient(r.Context(), client)))
+}
+
+// authorize returns the identity of the client of r, and an error unless
+// the client is authorized.
+func (h *Handler) authorize(r *http.Request) (string, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return "", errors.New("verified client certificate required")
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	identities := append([]string{leaf.Subject.CommonName}, leaf.DNSNames...)
+	for _, u := range leaf.URIs {
+		identities = append(identities, u.String())
+	}
+
+	if h.config.AllowAnyClient {
+		return identities[0], nil
+	}
+	for _, identity := range identities {
+		if identity != "" && slices.Contains(h.config.Clients, identity) {
+			return identity, nil
+		}
+	}
+	return identities[0], errors.New("client not authorized")
+}
+
+func (h *Handler) check(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, CheckResponse{AppIDs: h.config.AppIDs})
+}
+
+func (h *Handler) sign(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := h.logger.With("client", clientFrom(ctx))
+
+	var request SignRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		logger.Warn("invalid sign request", "error", err)
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+
+	claims, err := h.validate(request.Claims, time.Now())
+	if err != nil {
+		logger.Warn("refused to sign claims", "app_id", request.Claims.Issuer, "error", err)
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	token, err := h.provider.SignContext(ctx, claims)
+	if err != nil {
+		logger.Error("sign failed", "app_id", claims.Issuer, "error", err)
+		writeError(w, http.StatusBadGateway, errors.New("sign failed"))
+		return
+	}
+
+	logger.Info("signed app token", "app_id", claims.Issuer, "expires_at", claims.ExpiresAt.Time)
+	writeJSON(w, http.StatusOK, SignResponse{Token: token})
+}
+
+// validate returns the JWT claims for c, or an error unless c are the
+// claims of a GitHub App JWT for an allowed app, issued around now and
+// expiring within the maximum lifetime.
+func (h *Handler) validate(c Claims, now time.Time) (*jwt.RegisteredClaims, error) {
+	appID, err := strconv.ParseInt(c.Issuer, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuer %q: expected app ID", c.Issuer)
+	}
+	if !slices.Contains(h.config.AppIDs, appID) {
+		return nil, fmt.Errorf("app ID %d not allowed", appID)
+	}
+
+	iat, exp := time.Unix(c.IssuedAt, 0), time.Unix(c.ExpiresAt, 0)
+	switch {
+	case c.IssuedAt == 0 || c.ExpiresAt == 0:
+		return nil, errors.New("iat and exp claims are required")
+	case iat.Before(now.Add(-h.config.ClockSkew)) || iat.After(now.Add(h.config.ClockSkew)):
+		return nil, fmt.Errorf("iat %s not within %s of server time", iat.UTC().Format(time.RFC3339), h.config.ClockSkew)
+	case !exp.After(iat):
+		return nil, errors.New("exp must be after iat")
+	case !exp.After(now):
+		return nil, fmt.Errorf("exp %s already passed", exp.UTC().Format(time.RFC3339))
+	case exp.Sub(iat) > h.config.MaxLifetime:
+		return nil, fmt.Errorf("lifetime %s exceeds maximum %s", exp.Sub(iat), h.config.MaxLifetime)
+	}
+
+	return &jwt.RegisteredClaims{
+		Issuer:    c.Issuer,
+		IssuedAt:  jwt.NewNumericDate(iat),
+		ExpiresAt: jwt.NewNumericDate(exp),
+	}, nil
+}
+
+// ServerTLSConfig returns a TLS configuration serving the certificate and
+// key in the PEM files certFile and keyFile, and requiring client
+// certificates verified against the CA certificates in clientCAFile.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load server certificate: %w", err)
+	}
+
+	clientCAs, err := loadCertPool(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client CA: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientTLSConfig returns a TLS configuration presenting the client
+// certificate and key in the PEM files certFile and keyFile, and verifying
+// the server certificate against the CA certificates in caFile, or the
+// system roots if empty, for serverName if non-empty.
+func ClientTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		if config.RootCAs, err = loadCertPool(caFile); err != nil {
+			return nil, fmt.Errorf("load CA: %w", err)
+		}
+	}
+	return config, nil
+}
+
+// loadCertPool returns a pool of the certificates in the PEM file name.
+func loadCertPool(name string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", name)
+	}
+	return pool, nil
+}
+
+type clientKey struct{}
+
+func withClient(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+func clientFrom(ctx context.Context) string {
+	client, _ := ctx.Value(clientKey{}).(string)
+	return client
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,219 @@
+package signer_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/isometry/ghait/ghaittest"
+	"github.com/isometry/ghait/provider"
+	_ "github.com/isometry/ghait/provider/remote"
+	"github.com/isometry/ghait/signer"
+	"github.com/isometry/ghait/signer/signertest"
+)
+
+// newServer returns a signing server signing with a new key for app 12345,
+// as authorized by cfg.
+func newServer(t *testing.T, cfg signer.Config) (*signertest.Server, *ghaittest.Provider) {
+	t.Helper()
+
+	p, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	if cfg.AppIDs == nil {
+		cfg.AppIDs = []int64{12345}
+	}
+	handler, err := signer.NewHandler(p, cfg, nil)
+	require.NoError(t, err)
+
+	server, err := signertest.NewServer(handler)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+	return server, p
+}
+
+// newRemote returns a remote provider calling server with a client
+// certificate for name.
+func newRemote(t *testing.T, server *signertest.Server, name string, uris ...string) provider.Provider {
+	t.Helper()
+
+	certFile, keyFile, err := server.IssueClient(name, uris...)
+	require.NoError(t, err)
+
+	remote, err := provider.NewSignerWithOptions(context.Background(), "remote", server.URL, provider.Options{
+		"cert_file": certFile,
+		"key_file":  keyFile,
+		"ca_file":   server.CAFile,
+	})
+	require.NoError(t, err)
+	return remote
+}
+
+func appClaims(issuer string, iat time.Time, lifetime time.Duration) *jwt.RegisteredClaims {
+	return &jwt.RegisteredClaims{
+		Issuer:    issuer,
+		IssuedAt:  jwt.NewNumericDate(iat),
+		ExpiresAt: jwt.NewNumericDate(iat.Add(lifetime)),
+	}
+}
+
+func TestHandler_Sign(t *testing.T) {
+	server, p := newServer(t, signer.Config{Clients: []string{"ci-runner"}})
+	remote := newRemote(t, server, "ci-runner")
+	require.NoError(t, remote.Check(context.Background()))
+
+	now := time.Now()
+	tests := map[string]struct {
+		claims *jwt.RegisteredClaims
+		err    string
+	}{
+		"app JWT":          {claims: appClaims("12345", now.Add(-30*time.Second), 2*time.Minute)},
+		"maximum lifetime": {claims: appClaims("12345", now, 10*time.Minute)},
+		"other app":        {claims: appClaims("54321", now, time.Minute), err: "app ID 54321 not allowed"},
+		"not an app":       {claims: appClaims("github", now, time.Minute), err: `invalid issuer "github"`},
+		"long lifetime":    {claims: appClaims("12345", now, time.Hour), err: "lifetime 1h0m0s exceeds maximum 10m0s"},
+		"issued earlier":   {claims: appClaims("12345", now.Add(-5*time.Minute), 10*time.Minute), err: "not within 2m0s of server time"},
+		"issued later":     {claims: appClaims("12345", now.Add(5*time.Minute), time.Minute), err: "not within 2m0s of server time"},
+		"expired":          {claims: appClaims("12345", now.Add(-90*time.Second), time.Minute), err: "already passed"},
+		"inverted":         {claims: appClaims("12345", now, -time.Minute), err: "exp must be after iat"},
+		"missing exp":      {claims: &jwt.RegisteredClaims{Issuer: "12345", IssuedAt: jwt.NewNumericDate(now)}, err: "iat and exp claims are required"},
+		"extra claims": {
+			claims: &jwt.RegisteredClaims{Issuer: "12345", Subject: "admin", IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute))},
+			err:    `unsupported claims: json: unknown field "sub"`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			signed, err := remote.SignContext(context.Background(), tt.claims)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+
+			parsed, err := jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, func(*jwt.Token) (any, error) {
+				return p.PublicKey(), nil
+			}, jwt.WithValidMethods([]string{"RS256"}))
+			require.NoError(t, err)
+			assert.Equal(t, tt.claims, parsed.Claims)
+		})
+	}
+}
+
+func TestHandler_StrictRequest(t *testing.T) {
+	server, p := newServer(t, signer.Config{AllowAnyClient: true})
+	certFile, keyFile, err := server.IssueClient("ci-runner")
+	require.NoError(t, err)
+
+	config, err := signer.ClientTLSConfig(certFile, keyFile, server.CAFile, "")
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+
+	now := time.Now().Unix()
+	for name, body := range map[string]any{
+		"extra claim": map[string]any{"claims": map[string]any{"iss": "12345", "iat": now, "exp": now + 60, "sub": "admin"}},
+		"extra field": map[string]any{"claims": map[string]any{"iss": "12345", "iat": now, "exp": now + 60}, "payload": "data"},
+		"not claims":  "sign this",
+	} {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := json.Marshal(body)
+			require.NoError(t, err)
+
+			resp, err := client.Post(server.URL+signer.SignPath, "application/json", bytes.NewReader(encoded))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+	assert.Zero(t, p.SignCount())
+}
+
+func TestHandler_Authorization(t *testing.T) {
+	server, p := newServer(t, signer.Config{Clients: []string{"ci-runner", "spiffe://example.org/ci"}})
+	claims := appClaims("12345", time.Now(), time.Minute)
+
+	t.Run("common name", func(t *testing.T) {
+		_, err := newRemote(t, server, "ci-runner").SignContext(context.Background(), claims)
+		require.NoError(t, err)
+	})
+
+	t.Run("URI", func(t *testing.T) {
+		_, err := newRemote(t, server, "runner-7", "spiffe://example.org/ci").SignContext(context.Background(), claims)
+		require.NoError(t, err)
+	})
+
+	t.Run("unauthorized client", func(t *testing.T) {
+		remote := newRemote(t, server, "laptop")
+		assert.ErrorContains(t, remote.Check(context.Background()), "403 Forbidden: client not authorized")
+		_, err := remote.SignContext(context.Background(), claims)
+		assert.ErrorContains(t, err, "client not authorized")
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		other, _ := newServer(t, signer.Config{AllowAnyClient: true})
+		certFile, keyFile, err := other.IssueClient("ci-runner")
+		require.NoError(t, err)
+
+		remote, err := provider.NewSignerWithOptions(context.Background(), "remote", server.URL, provider.Options{
+			"cert_file": certFile,
+			"key_file":  keyFile,
+			"ca_file":   server.CAFile,
+		})
+		require.NoError(t, err)
+		assert.Error(t, remote.Check(context.Background()))
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		client := server.Client()
+		client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{}
+		resp, err := client.Get(server.URL + signer.CheckPath)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		assert.Error(t, err)
+	})
+
+	assert.Equal(t, int64(2), p.SignCount())
+
+	t.Run("any client", func(t *testing.T) {
+		server, _ := newServer(t, signer.Config{AllowAnyClient: true})
+		_, err := newRemote(t, server, "laptop").SignContext(context.Background(), claims)
+		require.NoError(t, err)
+	})
+}
+
+func TestNewHandler(t *testing.T) {
+	p, err := ghaittest.NewProvider()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		cfg signer.Config
+		err string
+	}{
+		"no app IDs":      {cfg: signer.Config{Clients: []string{"ci-runner"}}, err: "at least one allowed app ID is required"},
+		"no clients":      {cfg: signer.Config{AppIDs: []int64{12345}}, err: "at least one allowed client is required"},
+		"clients and any": {cfg: signer.Config{AppIDs: []int64{12345}, Clients: []string{"ci-runner"}, AllowAnyClient: true}, err: "allowed clients cannot be given"},
+		"clients":         {cfg: signer.Config{AppIDs: []int64{12345}, Clients: []string{"ci-runner"}}},
+		"any client":      {cfg: signer.Config{AppIDs: []int64{12345}, AllowAnyClient: true}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := signer.NewHandler(p, tt.cfg, nil)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
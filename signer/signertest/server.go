@@ -0,0 +1,140 @@
+// Package signertest provides a signing server over mutual TLS with a
+// throwaway certificate authority, for testing clients of the signer
+// package without issuing real certificates.
+package signertest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Server is an HTTPS server requiring client certificates issued by its
+// certificate authority.
+type Server struct {
+	*httptest.Server
+
+	// CAFile is the PEM file holding the certificate verifying the server.
+	CAFile string
+
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	serial atomic.Int64
+}
+
+// NewServer starts and returns a new Server serving handler. The caller
+// should call Close when finished, to shut it down.
+func NewServer(handler http.Handler) (*Server, error) {
+	dir, err := os.MkdirTemp("", "signertest")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{dir: dir}
+	if s.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "signertest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &s.caKey.PublicKey, s.caKey)
+	if err != nil {
+		return nil, err
+	}
+	if s.ca, err = x509.ParseCertificate(der); err != nil {
+		return nil, err
+	}
+	s.serial.Store(1)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(s.ca)
+
+	s.Server = httptest.NewUnstartedServer(handler)
+	s.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	s.StartTLS()
+
+	s.CAFile = filepath.Join(dir, "ca.pem")
+	if err := writePEM(s.CAFile, "CERTIFICATE", s.Certificate().Raw); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close shuts down the server and removes its files.
+func (s *Server) Close() {
+	s.Server.Close()
+	_ = os.RemoveAll(s.dir)
+}
+
+// IssueClient issues a client certificate with the common name name and
+// the URI subject alternative names uris, returning the PEM files holding
+// the certificate and its private key.
+func (s *Server) IssueClient(name string, uris ...string) (certFile, keyFile string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	serial := big.NewInt(s.serial.Add(1))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return "", "", err
+		}
+		template.URIs = append(template.URIs, u)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, s.ca, &key.PublicKey, s.caKey)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	certFile = filepath.Join(s.dir, "client-"+serial.String()+".pem")
+	keyFile = filepath.Join(s.dir, "client-"+serial.String()+"-key.pem")
+	if err := writePEM(certFile, "CERTIFICATE", der); err != nil {
+		return "", "", err
+	}
+	if err := writePEM(keyFile, "PRIVATE KEY", keyDER); err != nil {
+		return "", "", err
+	}
+	return certFile, keyFile, nil
+}
+
+func writePEM(name, blockType string, der []byte) error {
+	return os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+}
@@ -0,0 +1,139 @@
+package ghait
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v80/github"
+)
+
+// SignLatencyBuckets are the upper bounds, in seconds, of the sign latency
+// histogram buckets.
+var SignLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// TokenKey identifies a class of issued tokens.
+type TokenKey struct {
+	InstallationID int64
+	// Profile is the policy profile applied to the request, if any.
+	Profile string
+}
+
+// Histogram is a snapshot of a latency histogram.
+type Histogram struct {
+	Count uint64
+	Sum   time.Duration
+	// Buckets holds the cumulative count of observations less than or equal
+	// to each of SignLatencyBuckets.
+	Buckets []uint64
+}
+
+// Stats is a point-in-time snapshot of the activity of a ghait instance.
+type Stats struct {
+	// AppID is the GitHub App ID of the ghait instance.
+	AppID int64
+	// Provider is the name of the signing provider.
+	Provider string
+	// TokensIssued counts the tokens issued by installation and profile.
+	TokensIssued map[TokenKey]uint64
+	// FatalErrors and TransientErrors count failed token requests by class.
+	FatalErrors     uint64
+	TransientErrors uint64
+	// SignLatency records the latency of provider signing operations.
+	SignLatency Histogram
+	// RateLimit is the GitHub primary rate limit state last observed in a
+	// response to a request authenticated as the app.
+	RateLimit github.Rate
+}
+
+// stats accumulates the activity of a ghait instance.
+type stats struct {
+	mu              sync.Mutex
+	tokensIssued    map[TokenKey]uint64
+	fatalErrors     uint64
+	transientErrors uint64
+	signLatency     Histogram
+	rateLimit       github.Rate
+}
+
+func newStats() *stats {
+	return &stats{
+		tokensIssued: map[TokenKey]uint64{},
+		signLatency:  Histogram{Buckets: make([]uint64, len(SignLatencyBuckets))},
+	}
+}
+
+func (s *stats) recordToken(key TokenKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokensIssued[key]++
+}
+
+func (s *stats) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if isTransient(err) {
+		s.transientErrors++
+	} else {
+		s.fatalErrors++
+	}
+}
+
+func (s *stats) recordSign(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.signLatency.Count++
+	s.signLatency.Sum += latency
+	for i, bound := range SignLatencyBuckets {
+		if latency.Seconds() <= bound {
+			s.signLatency.Buckets[i]++
+		}
+	}
+}
+
+// recordRate records the primary rate limit state reported in the
+// X-RateLimit headers of a response, if any.
+func (s *stats) recordRate(h http.Header) {
+	limit, _ := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if limit == 0 {
+		return
+	}
+
+	rate := github.Rate{Limit: limit, Resource: h.Get("X-RateLimit-Resource")}
+	rate.Remaining, _ = strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	rate.Used, _ = strconv.Atoi(h.Get("X-RateLimit-Used"))
+	if reset, _ := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); reset != 0 {
+		rate.Reset = github.Timestamp{Time: time.Unix(reset, 0)}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateLimit = rate
+}
+
+// Stats returns a snapshot of the activity of the ghait instance.
+func (g *ghait) Stats() Stats {
+	s := g.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	latency := s.signLatency
+	latency.Buckets = slices.Clone(latency.Buckets)
+
+	return Stats{
+		AppID:           g.appID,
+		Provider:        g.provider,
+		TokensIssued:    maps.Clone(s.tokensIssued),
+		FatalErrors:     s.fatalErrors,
+		TransientErrors: s.transientErrors,
+		SignLatency:     latency,
+		RateLimit:       s.rateLimit,
+	}
+}
@@ -0,0 +1,70 @@
+package ghait
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/isometry/ghait"
+
+// telemetry holds the OpenTelemetry instruments of a ghait instance.
+type telemetry struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+
+	tracer       trace.Tracer
+	tokensIssued metric.Int64Counter
+	tokenErrors  metric.Int64Counter
+	signDuration metric.Float64Histogram
+}
+
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) (*telemetry, error) {
+	if tp == nil {
+		tp = tracenoop.NewTracerProvider()
+	}
+	if mp == nil {
+		mp = metricnoop.NewMeterProvider()
+	}
+
+	meter := mp.Meter(instrumentationName)
+	t := &telemetry{
+		tracerProvider: tp,
+		meterProvider:  mp,
+		tracer:         tp.Tracer(instrumentationName),
+	}
+
+	var err error
+	if t.tokensIssued, err = meter.Int64Counter(
+		"ghait.tokens.issued",
+		metric.WithDescription("Number of installation tokens issued"),
+		metric.WithUnit("{token}"),
+	); err != nil {
+		return nil, err
+	}
+	if t.tokenErrors, err = meter.Int64Counter(
+		"ghait.tokens.errors",
+		metric.WithDescription("Number of failed installation token requests, by error class"),
+		metric.WithUnit("{error}"),
+	); err != nil {
+		return nil, err
+	}
+	if t.signDuration, err = meter.Float64Histogram(
+		"ghait.sign.duration",
+		metric.WithDescription("Duration of provider signing operations"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func errorClass(err error) attribute.KeyValue {
+	if isTransient(err) {
+		return attribute.String("error.class", "transient")
+	}
+	return attribute.String("error.class", "fatal")
+}
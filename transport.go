@@ -0,0 +1,61 @@
+package ghait
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// appsTransport is an http.RoundTripper authenticating requests as a GitHub
+// App, signing a fresh JWT for each request within the request's context.
+//
+// It replaces ghinstallation.AppsTransport, whose Signer takes no context,
+// so could neither carry the request context to the provider nor parent the
+// sign span to the token request span. The claims, their clock skew and the
+// absence of JWT caching are those of ghinstallation.AppsTransport.
+type appsTransport struct {
+	base   http.RoundTripper
+	appID  int64
+	signer *instrumentedSigner
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *appsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// GitHub rejects fractional timestamps and tolerates limited clock
+	// drift, so backdate the issue time and truncate to the second.
+	iat := time.Now().Add(-30 * time.Second).Truncate(time.Second)
+	claims := &jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(iat),
+		ExpiresAt: jwt.NewNumericDate(iat.Add(2 * time.Minute)),
+		Issuer:    strconv.FormatInt(t.appID, 10),
+	}
+
+	signed, err := t.signer.sign(req.Context(), claims)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign jwt: %w", err)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+signed)
+
+	return t.base.RoundTrip(req)
+}
+
+// rateTransport is an http.RoundTripper recording the rate limit state
+// reported in every response.
+type rateTransport struct {
+	base  http.RoundTripper
+	stats *stats
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *rateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if resp != nil {
+		t.stats.recordRate(resp.Header)
+	}
+	return resp, err
+}